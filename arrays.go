@@ -1,7 +1,6 @@
 package ndr
 
 import (
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"reflect"
@@ -62,6 +61,34 @@ func sliceDimensions(t reflect.Type) (d int, tb reflect.Type) {
 	return
 }
 
+// sliceLengths returns the length of each of the d dimensions of a slice or array value. NDR arrays are rectangular so
+// an error is returned if the sub slices of a dimension are not all of the same length.
+func sliceLengths(v reflect.Value, d int) ([]int, error) {
+	l := []int{v.Len()}
+	if d < 2 {
+		return l, nil
+	}
+	if v.Len() == 0 {
+		return append(l, make([]int, d-1)...), nil
+	}
+	m, err := sliceLengths(v.Index(0), d-1)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < v.Len(); i++ {
+		n, err := sliceLengths(v.Index(i), d-1)
+		if err != nil {
+			return nil, err
+		}
+		for j := range m {
+			if m[j] != n[j] {
+				return nil, fmt.Errorf("sub slices of dimension %d differ in length (%d != %d)", j+2, m[j], n[j])
+			}
+		}
+	}
+	return append(l, m...), nil
+}
+
 // makeSubSlices is a deep recursive creation/initialisation of multi-dimensional slices.
 // Takes the reflect.Value of the 1st dimension and a slice of the lengths of the sub dimensions
 func makeSubSlices(v reflect.Value, l []int) {
@@ -120,7 +147,7 @@ func (enc *Encoder) precedingMax() uint32 {
 // fillFixedArray establishes if the fixed array is uni or multi dimensional and then fills it.
 func (dec *Decoder) fillFixedArray(v reflect.Value, tag reflect.StructTag, def *[]deferedPtr) error {
 	l, t := parseDimensions(v)
-	if t.Kind() == reflect.String {
+	if t.Kind() == reflect.String && !isElementPointer(tag) {
 		tag = reflect.StructTag(subStringArrayTag)
 	}
 	if len(l) < 1 {
@@ -153,7 +180,7 @@ func (dec *Decoder) fillFixedArray(v reflect.Value, tag reflect.StructTag, def *
 // readUniDimensionalFixedArray reads an array (not slice) from the byte stream.
 func (dec *Decoder) fillUniDimensionalFixedArray(v reflect.Value, tag reflect.StructTag, def *[]deferedPtr) error {
 	for i := 0; i < v.Len(); i++ {
-		err := dec.fill(v.Index(i), tag, def)
+		err := dec.fill(v.Index(i), elementTag(tag, v.Index(i)), def)
 		if err != nil {
 			return fmt.Errorf("could not fill index %d of fixed array: %v", i, err)
 		}
@@ -183,9 +210,13 @@ func (dec *Decoder) fillUniDimensionalConformantArray(v reflect.Value, tag refle
 	m := dec.precedingMax()
 	n := int(m)
 	//fmt.Printf("Encountered conformant array with max count: %d for field: %v\n", m, dec.current)
+	err := checkCounts(tag, n, -1, -1)
+	if err != nil {
+		return fmt.Errorf("uni-dimensional conformant array: %v", err)
+	}
 	a := reflect.MakeSlice(v.Type(), n, n)
 	for i := 0; i < n; i++ {
-		err := dec.fill(a.Index(i), tag, def)
+		err := dec.fill(a.Index(i), elementTag(tag, a.Index(i)), def)
 		if err != nil {
 			return fmt.Errorf("could not fill index %d of uni-dimensional conformant array: %v", i, err)
 		}
@@ -218,7 +249,7 @@ func (dec *Decoder) fillMultiDimensionalConformantArray(v reflect.Value, d int,
 		for _, i := range p {
 			a = a.Index(i)
 		}
-		err := dec.fill(a, tag, def)
+		err := dec.fill(a, elementTag(tag, a), def)
 		if err != nil {
 			return fmt.Errorf("could not fill index %v of slice: %v", p, err)
 		}
@@ -245,21 +276,25 @@ func (dec *Decoder) fillVaryingArray(v reflect.Value, tag reflect.StructTag, def
 
 // fillUniDimensionalVaryingArray fills the uni-dimensional slice value.
 func (dec *Decoder) fillUniDimensionalVaryingArray(v reflect.Value, tag reflect.StructTag, def *[]deferedPtr) error {
-	o, err := dec.readUint32()
+	o, err := dec.readCount()
 	if err != nil {
 		return fmt.Errorf("could not read offset of uni-dimensional varying array: %v", err)
 	}
-	s, err := dec.readUint32()
+	s, err := dec.readCount()
 	if err != nil {
 		return fmt.Errorf("could not establish actual count of uni-dimensional varying array: %v", err)
 	}
+	err = checkCounts(tag, -1, int(o), int(s))
+	if err != nil {
+		return fmt.Errorf("uni-dimensional varying array: %v", err)
+	}
 	t := v.Type()
 	// Total size of the array is the offset in the index being passed plus the actual count of elements being passed.
 	n := int(s + o)
 	a := reflect.MakeSlice(t, n, n)
 	// Populate the array starting at the offset specified
 	for i := int(o); i < n; i++ {
-		err := dec.fill(a.Index(i), tag, def)
+		err := dec.fill(a.Index(i), elementTag(tag, a.Index(i)), def)
 		if err != nil {
 			return fmt.Errorf("could not fill index %d of uni-dimensional varying array: %v", i, err)
 		}
@@ -276,12 +311,12 @@ func (dec *Decoder) fillMultiDimensionalVaryingArray(v reflect.Value, t reflect.
 	o := make([]int, d, d)
 	l := make([]int, d, d)
 	for i := range l {
-		off, err := dec.readUint32()
+		off, err := dec.readCount()
 		if err != nil {
 			return fmt.Errorf("could not read offset of dimension %d: %v", i+1, err)
 		}
 		o[i] = int(off)
-		s, err := dec.readUint32()
+		s, err := dec.readCount()
 		if err != nil {
 			return fmt.Errorf("could not read size of dimension %d: %v", i+1, err)
 		}
@@ -311,7 +346,7 @@ func (dec *Decoder) fillMultiDimensionalVaryingArray(v reflect.Value, t reflect.
 			// This permutation should be skipped as it is less than the offset for one of the dimensions.
 			continue
 		}
-		err := dec.fill(a, tag, def)
+		err := dec.fill(a, elementTag(tag, a), def)
 		if err != nil {
 			return fmt.Errorf("could not fill index %v of slice: %v", p, err)
 		}
@@ -328,7 +363,7 @@ func (dec *Decoder) fillConformantVaryingArray(v reflect.Value, tag reflect.Stru
 			return err
 		}
 	} else {
-		err := dec.fillUniDimensionalConformantVaryingArray(v, tag, def)
+		err := dec.fillUniDimensionalConformantVaryingElements(v, tag, def, true)
 		if err != nil {
 			return err
 		}
@@ -336,14 +371,22 @@ func (dec *Decoder) fillConformantVaryingArray(v reflect.Value, tag reflect.Stru
 	return nil
 }
 
-// fillUniDimensionalConformantVaryingArray fills the uni-dimensional slice value.
+// fillUniDimensionalConformantVaryingArray fills the uni-dimensional slice value with the elements up to the end of
+// the transmitted window, as for the characters of a conformant varying string.
 func (dec *Decoder) fillUniDimensionalConformantVaryingArray(v reflect.Value, tag reflect.StructTag, def *[]deferedPtr) error {
+	return dec.fillUniDimensionalConformantVaryingElements(v, tag, def, false)
+}
+
+// fillUniDimensionalConformantVaryingElements fills the uni-dimensional slice value. If toMax is set the slice has the
+// length of the max count, with the elements outside of the transmitted window left as zero values, so that the max
+// count is kept when the value is encoded again. Otherwise the slice ends with the transmitted window.
+func (dec *Decoder) fillUniDimensionalConformantVaryingElements(v reflect.Value, tag reflect.StructTag, def *[]deferedPtr, toMax bool) error {
 	m := dec.precedingMax()
-	o, err := dec.readUint32()
+	o, err := dec.readCount()
 	if err != nil {
 		return fmt.Errorf("could not read offset of uni-dimensional conformant varying array: %v", err)
 	}
-	s, err := dec.readUint32()
+	s, err := dec.readCount()
 	if err != nil {
 		return fmt.Errorf("could not establish actual count of uni-dimensional conformant varying array: %v", err)
 	}
@@ -352,12 +395,21 @@ func (dec *Decoder) fillUniDimensionalConformantVaryingArray(v reflect.Value, ta
 		fmt.Printf("Max count is: %d, actual: %d, offset: %d\n", m, s, o)
 		return errors.New("max count is less than the offset plus actual count")
 	}
+	err = checkCounts(tag, int(m), int(o), int(s))
+	if err != nil {
+		return fmt.Errorf("uni-dimensional conformant varying array: %v", err)
+	}
 	//fmt.Printf("Preparing to read string of length: %d\n", s)
 	t := v.Type()
-	n := int(s)
-	a := reflect.MakeSlice(t, n, n)
+	// The elements being passed end at the offset plus the actual count
+	n := int(s + o)
+	l := n
+	if toMax {
+		l = int(m)
+	}
+	a := reflect.MakeSlice(t, l, l)
 	for i := int(o); i < n; i++ {
-		err := dec.fill(a.Index(i), tag, def)
+		err := dec.fill(a.Index(i), elementTag(tag, a.Index(i)), def)
 		if err != nil {
 			return fmt.Errorf("could not fill index %d of uni-dimensional conformant varying array: %v", i, err)
 		}
@@ -378,12 +430,12 @@ func (dec *Decoder) fillMultiDimensionalConformantVaryingArray(v reflect.Value,
 	o := make([]int, d, d)
 	l := make([]int, d, d)
 	for i := range l {
-		off, err := dec.readUint32()
+		off, err := dec.readCount()
 		if err != nil {
 			return fmt.Errorf("could not read offset of dimension %d: %v", i+1, err)
 		}
 		o[i] = int(off)
-		s, err := dec.readUint32()
+		s, err := dec.readCount()
 		if err != nil {
 			return fmt.Errorf("could not read actual count of dimension %d: %v", i+1, err)
 		}
@@ -416,7 +468,7 @@ func (dec *Decoder) fillMultiDimensionalConformantVaryingArray(v reflect.Value,
 			// This permutation should be skipped as it is less than the offset for one of the dimensions.
 			continue
 		}
-		err := dec.fill(a, tag, def)
+		err := dec.fill(a, elementTag(tag, a), def)
 		if err != nil {
 			return fmt.Errorf("could not fill index %v of slice: %v", p, err)
 		}
@@ -424,9 +476,10 @@ func (dec *Decoder) fillMultiDimensionalConformantVaryingArray(v reflect.Value,
 	return nil
 }
 
+// writeFixedArray establishes if the fixed array is uni or multi dimensional and then writes it.
 func (enc *Encoder) writeFixedArray(v reflect.Value, tag reflect.StructTag, def *[]deferedPtr) error {
 	l, t := parseDimensions(v)
-	if t.Kind() == reflect.String {
+	if t.Kind() == reflect.String && !isElementPointer(tag) {
 		tag = reflect.StructTag(subStringArrayTag)
 	}
 	if len(l) < 1 {
@@ -439,28 +492,30 @@ func (enc *Encoder) writeFixedArray(v reflect.Value, tag reflect.StructTag, def
 		}
 		return nil
 	}
-	return fmt.Errorf("Haven't implemented writing of multi-dimensional fixed arrays yet")
-
 	// Fixed array is multidimensional
-	//ps := multiDimensionalIndexPermutations(l[:len(l)-1])
-	//for _, p := range ps {
-	//	// Get current multi-dimensional index to fill
-	//	a := v
-	//	for _, i := range p {
-	//		a = a.Index(i)
-	//	}
-	//	// fill with the last dimension array
-	//	err := dec.fillUniDimensionalFixedArray(a, tag, def)
-	//	if err != nil {
-	//		return fmt.Errorf("could not fill dimension %v of multi-dimensional fixed array: %v", p, err)
-	//	}
-	//}
+	if hasEmptyDimension(l) {
+		return nil
+	}
+	ps := multiDimensionalIndexPermutations(l[:len(l)-1])
+	for _, p := range ps {
+		// Get current multi-dimensional index to write
+		a := v
+		for _, i := range p {
+			a = a.Index(i)
+		}
+		// write the last dimension array
+		err := enc.writeUniDimensionalFixedArray(a, tag, def)
+		if err != nil {
+			return fmt.Errorf("could not write dimension %v of multi-dimensional fixed array: %v", p, err)
+		}
+	}
 	return nil
 }
 
+// writeUniDimensionalFixedArray writes each element of the array or slice without any counts.
 func (enc *Encoder) writeUniDimensionalFixedArray(v reflect.Value, tag reflect.StructTag, def *[]deferedPtr) error {
 	for i := 0; i < v.Len(); i++ {
-		err := enc.fill(v.Index(i), tag, def)
+		err := enc.fill(v.Index(i), elementTag(tag, v.Index(i)), def)
 		if err != nil {
 			return fmt.Errorf("could not fill index %d of fixed array: %v", i, err)
 		}
@@ -468,14 +523,26 @@ func (enc *Encoder) writeUniDimensionalFixedArray(v reflect.Value, tag reflect.S
 	return nil
 }
 
+// hasEmptyDimension reports whether any of the dimensions has a length of zero in which case there are no elements
+// to write.
+func hasEmptyDimension(l []int) bool {
+	for _, n := range l {
+		if n == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// writeConformantArray establishes if the conformant array is uni or multi dimensional and then writes the slice.
+// The max counts have already been written at the beginning of the structure.
 func (enc *Encoder) writeConformantArray(v reflect.Value, tag reflect.StructTag, def *[]deferedPtr) error {
 	d, _ := sliceDimensions(v.Type())
 	if d > 1 {
-		return fmt.Errorf("Haven't implemented writing of multi-dimensional conformant arrays yet")
-		//err := enc.fillMultiDimensionalConformantArray(v, d, tag, def)
-		//if err != nil {
-		//	return err
-		//}
+		err := enc.writeMultiDimensionalConformantArray(v, d, tag, def)
+		if err != nil {
+			return err
+		}
 	} else {
 		err := enc.writeUniDimensionalFixedArray(v, tag, def)
 		if err != nil {
@@ -485,15 +552,44 @@ func (enc *Encoder) writeConformantArray(v reflect.Value, tag reflect.StructTag,
 	return nil
 }
 
-// fillVaryingArray establishes if the varying array is uni or multi dimensional and then fills the slice.
+// writeMultiDimensionalConformantArray writes the elements of the multi-dimensional slice in row-major order.
+func (enc *Encoder) writeMultiDimensionalConformantArray(v reflect.Value, d int, tag reflect.StructTag, def *[]deferedPtr) error {
+	l, err := sliceLengths(v, d)
+	if err != nil {
+		return fmt.Errorf("could not establish dimensions of multi-dimensional conformant array: %v", err)
+	}
+	return enc.writeMultiDimensionalElements(v, l, tag, def)
+}
+
+// writeMultiDimensionalElements writes every element of a multi-dimensional slice with the dimension lengths l.
+func (enc *Encoder) writeMultiDimensionalElements(v reflect.Value, l []int, tag reflect.StructTag, def *[]deferedPtr) error {
+	if hasEmptyDimension(l) {
+		return nil
+	}
+	// Get all permutations of the indexes and go through each and write
+	ps := multiDimensionalIndexPermutations(l)
+	for _, p := range ps {
+		// Get current multi-dimensional index to write
+		a := v
+		for _, i := range p {
+			a = a.Index(i)
+		}
+		err := enc.fill(a, elementTag(tag, a), def)
+		if err != nil {
+			return fmt.Errorf("could not write index %v of slice: %v", p, err)
+		}
+	}
+	return nil
+}
+
+// writeVaryingArray establishes if the varying array is uni or multi dimensional and then writes the slice.
 func (enc *Encoder) writeVaryingArray(v reflect.Value, tag reflect.StructTag, def *[]deferedPtr) error {
 	d, _ := sliceDimensions(v.Type())
 	if d > 1 {
-		//err := dec.fillMultiDimensionalVaryingArray(v, t, d, tag, def)
-		//if err != nil {
-		//	return err
-		//}
-		return fmt.Errorf("Haven't implemented writing of multi-dimensional varying arrays yet")
+		err := enc.writeMultiDimensionalVaryingArray(v, d, tag, def)
+		if err != nil {
+			return err
+		}
 	} else {
 		err := enc.writeUniDimensionalVaryingArray(v, tag, def)
 		if err != nil {
@@ -503,32 +599,64 @@ func (enc *Encoder) writeVaryingArray(v reflect.Value, tag reflect.StructTag, de
 	return nil
 }
 
-// fillUniDimensionalVaryingArray fills the uni-dimensional slice value.
+// writeUniDimensionalVaryingArray writes the offset and actual count followed by the elements of the slice that are
+// within that window.
 func (enc *Encoder) writeUniDimensionalVaryingArray(v reflect.Value, tag reflect.StructTag, def *[]deferedPtr) error {
-	// Use an offset of 0
-	err := binary.Write(enc.w, enc.ch.Endianness, uint32(0))
+	o, s, err := varyingWindow(tag, v.Len())
+	if err != nil {
+		return fmt.Errorf("could not establish window of uni-dimensional varying array: %v", err)
+	}
+	err = enc.writeCount(uint32(o))
 	if err != nil {
 		return fmt.Errorf("could not write offset of uni-dimensional varying array: %v", err)
 	}
-	err = binary.Write(enc.w, enc.ch.Endianness, uint32(v.Len()))
+	err = enc.writeCount(uint32(s))
 	if err != nil {
 		return fmt.Errorf("could not write actual count of uni-dimensional varying array: %v", err)
 	}
-	err = enc.writeUniDimensionalFixedArray(v, tag, def)
+	err = enc.writeUniDimensionalFixedArray(v.Slice(o, o+s), tag, def)
 	if err != nil {
 		return fmt.Errorf("could not write uni-dimensional varying array: %v", err)
 	}
 	return nil
 }
 
+// writeMultiDimensionalVaryingArray writes the offset and actual count of each dimension followed by the elements of
+// the multi-dimensional slice.
+func (enc *Encoder) writeMultiDimensionalVaryingArray(v reflect.Value, d int, tag reflect.StructTag, def *[]deferedPtr) error {
+	ndrTag := parseTags(tag)
+	for _, k := range windowTags {
+		if _, ok := ndrTag.Map[k]; ok {
+			return fmt.Errorf("%s is not supported for multi-dimensional varying arrays", k)
+		}
+	}
+	l, err := sliceLengths(v, d)
+	if err != nil {
+		return fmt.Errorf("could not establish dimensions of multi-dimensional varying array: %v", err)
+	}
+	for i := range l {
+		// Use an offset of 0
+		err = enc.writeCount(0)
+		if err != nil {
+			return fmt.Errorf("could not write offset of dimension %d: %v", i+1, err)
+		}
+		err = enc.writeCount(uint32(l[i]))
+		if err != nil {
+			return fmt.Errorf("could not write actual count of dimension %d: %v", i+1, err)
+		}
+	}
+	return enc.writeMultiDimensionalElements(v, l, tag, def)
+}
+
+// writeConformantVaryingArray establishes if the conformant varying array is uni or multi dimensional and then writes
+// the slice. The max counts have already been written at the beginning of the structure.
 func (enc *Encoder) writeConformantVaryingArray(v reflect.Value, tag reflect.StructTag, def *[]deferedPtr) error {
 	d, _ := sliceDimensions(v.Type())
 	if d > 1 {
-		//err := enc.writeMultiDimensionalConformantVaryingArray(v, t, d, tag, def)
-		//if err != nil {
-		//	return err
-		//}
-		return fmt.Errorf("Haven't implemented writing of multi-dimensional conformant varying arrays yet")
+		err := enc.writeMultiDimensionalVaryingArray(v, d, tag, def)
+		if err != nil {
+			return err
+		}
 	} else {
 		err := enc.writeUniDimensionalVaryingArray(v, tag, def)
 		if err != nil {
@@ -537,30 +665,3 @@ func (enc *Encoder) writeConformantVaryingArray(v reflect.Value, tag reflect.Str
 	}
 	return nil
 }
-
-// writeUniDimensionalConformantVaryingArray writes the uni-dimensional slice value.
-//func (enc *Encoder) writeUniDimensionalConformantVaryingArray(v reflect.Value, tag reflect.StructTag, def *[]deferedPtr) error {
-//	o, err := enc.readUint32()
-//	if err != nil {
-//		return fmt.Errorf("could not read offset of uni-dimensional conformant varying array: %v", err)
-//	}
-//	s, err := enc.readUint32()
-//	if err != nil {
-//		return fmt.Errorf("could not establish actual count of uni-dimensional conformant varying array: %v", err)
-//	}
-//	if m < o+s {
-//		return errors.New("max count is less than the offset plus actual count")
-//	}
-//	t := v.Type()
-//	n := int(s)
-//	a := reflect.MakeSlice(t, n, n)
-//	for i := int(o); i < n; i++ {
-//		err := enc.write(a.Index(i), tag, def)
-//		if err != nil {
-//			return fmt.Errorf("could not write index %d of uni-dimensional conformant varying array: %v", i, err)
-//		}
-//	}
-//	v.Set(a)
-//	return nil
-//}
-
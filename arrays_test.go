@@ -10,7 +10,17 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-const TestHeader = "01100800cccccccca00400000000000000000200"
+const (
+	TestHeader                                 = "01100800cccccccca00400000000000000000200"
+	testUniDimensionalFixedArray               = "01000000020000000300000004000000"
+	testMultiDimensionalFixedArray             = "0100000002000000030000000400000005000000060000000700000008000000090000000a0000000b0000000c000000"
+	testUniDimensionalConformantArray          = "0400000001000000020000000300000004000000"
+	testMultiDimensionalConformantArray        = "0200000003000000020000000100000002000000030000000400000005000000060000000700000008000000090000000a0000000b0000000c000000"
+	testUniDimensionalVaryingArray             = "000000000400000001000000020000000300000004000000"
+	testMultiDimensionalVaryingArray           = "0000000002000000000000000300000000000000020000000100000002000000030000000400000005000000060000000700000008000000090000000a0000000b0000000c000000"
+	testUniDimensionalConformantVaryingArray   = "04000000000000000400000001000000020000000300000004000000"
+	testMultiDimensionalConformantVaryingArray = "0200000003000000020000000000000002000000000000000300000000000000020000000100000002000000030000000400000005000000060000000700000008000000090000000a0000000b0000000c000000"
+)
 
 func TestParseDimensions(t *testing.T) {
 	a := [2][2][2][]SimpleTest{}
@@ -75,10 +85,10 @@ type StructWithMultiDimensionalConformantVaryingSlice struct {
 }
 
 func TestReadUniDimensionalFixedArray(t *testing.T) {
-	hexStr := TestHeader + "01000000020000000300000004000000"
+	hexStr := TestHeader + testUniDimensionalFixedArray
 	b, _ := hex.DecodeString(hexStr)
 	a := new(StructWithArray)
-	dec := NewDecoder(bytes.NewReader(b))
+	dec := NewDecoder(bytes.NewReader(b), true)
 	err := dec.Decode(a)
 	if err != nil {
 		t.Fatalf("%v", err)
@@ -89,10 +99,10 @@ func TestReadUniDimensionalFixedArray(t *testing.T) {
 }
 
 func TestReadMultiDimensionalFixedArray(t *testing.T) {
-	hexStr := TestHeader + "0100000002000000030000000400000005000000060000000700000008000000090000000a0000000b0000000c0000000d0000000e0000000f000000100000001100000012000000130000001400000015000000160000001700000018000000190000001a0000001b0000001c0000001d0000001e0000001f0000002000000021000000220000002300000024000000"
+	hexStr := TestHeader + testMultiDimensionalFixedArray
 	b, _ := hex.DecodeString(hexStr)
 	a := new(StructWithMultiDimArray)
-	dec := NewDecoder(bytes.NewReader(b))
+	dec := NewDecoder(bytes.NewReader(b), true)
 	err := dec.Decode(a)
 	if err != nil {
 		t.Fatalf("%v", err)
@@ -113,10 +123,10 @@ func TestReadMultiDimensionalFixedArray(t *testing.T) {
 }
 
 func TestReadUniDimensionalConformantArray(t *testing.T) {
-	hexStr := TestHeader + "0400000001000000020000000300000004000000"
+	hexStr := TestHeader + testUniDimensionalConformantArray
 	b, _ := hex.DecodeString(hexStr)
 	a := new(StructWithConformantSlice)
-	dec := NewDecoder(bytes.NewReader(b))
+	dec := NewDecoder(bytes.NewReader(b), true)
 	err := dec.Decode(a)
 	if err != nil {
 		t.Fatalf("%v", err)
@@ -127,10 +137,10 @@ func TestReadUniDimensionalConformantArray(t *testing.T) {
 }
 
 func TestReadMultiDimensionalConformantArray(t *testing.T) {
-	hexStr := TestHeader + "0200000003000000020000000100000002000000030000000400000005000000060000000700000008000000090000000a0000000b0000000c0000000d0000000e0000000f000000100000001100000012000000130000001400000015000000160000001700000018000000190000001a0000001b0000001c0000001d0000001e0000001f0000002000000021000000220000002300000024000000"
+	hexStr := TestHeader + testMultiDimensionalConformantArray
 	b, _ := hex.DecodeString(hexStr)
 	a := new(StructWithMultiDimensionalConformantSlice)
-	dec := NewDecoder(bytes.NewReader(b))
+	dec := NewDecoder(bytes.NewReader(b), true)
 	err := dec.Decode(a)
 	if err != nil {
 		t.Fatalf("%v", err)
@@ -151,10 +161,10 @@ func TestReadMultiDimensionalConformantArray(t *testing.T) {
 }
 
 func TestReadUniDimensionalVaryingArray(t *testing.T) {
-	hexStr := TestHeader + "000000000400000001000000020000000300000004000000"
+	hexStr := TestHeader + testUniDimensionalVaryingArray
 	b, _ := hex.DecodeString(hexStr)
 	a := new(StructWithVaryingSlice)
-	dec := NewDecoder(bytes.NewReader(b))
+	dec := NewDecoder(bytes.NewReader(b), true)
 	err := dec.Decode(a)
 	if err != nil {
 		t.Fatalf("%v", err)
@@ -165,10 +175,10 @@ func TestReadUniDimensionalVaryingArray(t *testing.T) {
 }
 
 func TestReadMultiDimensionalVaryingArray(t *testing.T) {
-	hexStr := TestHeader + "0000000002000000000000000300000000000000020000000100000002000000030000000400000005000000060000000700000008000000090000000a0000000b0000000c0000000d0000000e0000000f000000100000001100000012000000130000001400000015000000160000001700000018000000190000001a0000001b0000001c0000001d0000001e0000001f0000002000000021000000220000002300000024000000"
+	hexStr := TestHeader + testMultiDimensionalVaryingArray
 	b, _ := hex.DecodeString(hexStr)
 	a := new(StructWithMultiDimensionalVaryingSlice)
-	dec := NewDecoder(bytes.NewReader(b))
+	dec := NewDecoder(bytes.NewReader(b), true)
 	err := dec.Decode(a)
 	if err != nil {
 		t.Fatalf("%v", err)
@@ -189,10 +199,10 @@ func TestReadMultiDimensionalVaryingArray(t *testing.T) {
 }
 
 func TestReadUniDimensionalConformantVaryingArray(t *testing.T) {
-	hexStr := TestHeader + "04000000000000000400000001000000020000000300000004000000"
+	hexStr := TestHeader + testUniDimensionalConformantVaryingArray
 	b, _ := hex.DecodeString(hexStr)
 	a := new(StructWithConformantVaryingSlice)
-	dec := NewDecoder(bytes.NewReader(b))
+	dec := NewDecoder(bytes.NewReader(b), true)
 	err := dec.Decode(a)
 	if err != nil {
 		t.Fatalf("%v", err)
@@ -203,10 +213,10 @@ func TestReadUniDimensionalConformantVaryingArray(t *testing.T) {
 }
 
 func TestReadMultiDimensionalConformantVaryingArray(t *testing.T) {
-	hexStr := TestHeader + "0200000003000000020000000000000002000000000000000300000000000000020000000100000002000000030000000400000005000000060000000700000008000000090000000a0000000b0000000c0000000d0000000e0000000f000000100000001100000012000000130000001400000015000000160000001700000018000000190000001a0000001b0000001c0000001d0000001e0000001f0000002000000021000000220000002300000024000000"
+	hexStr := TestHeader + testMultiDimensionalConformantVaryingArray
 	b, _ := hex.DecodeString(hexStr)
 	a := new(StructWithMultiDimensionalConformantVaryingSlice)
-	dec := NewDecoder(bytes.NewReader(b))
+	dec := NewDecoder(bytes.NewReader(b), true)
 	err := dec.Decode(a)
 	if err != nil {
 		t.Fatalf("%v", err)
@@ -225,3 +235,160 @@ func TestReadMultiDimensionalConformantVaryingArray(t *testing.T) {
 	}
 	assert.Equal(t, ar, a.A, "multi-dimensional conformant varying array not as expected")
 }
+
+func TestWriteArrays(t *testing.T) {
+	ar := [][][]uint32{
+		{
+			{1, 2},
+			{3, 4},
+			{5, 6},
+		},
+		{
+			{7, 8},
+			{9, 10},
+			{11, 12},
+		},
+	}
+	var tests = []struct {
+		Hex string
+		In  interface{}
+		Out interface{}
+	}{
+		{testUniDimensionalFixedArray, &StructWithArray{A: [4]uint32{1, 2, 3, 4}}, new(StructWithArray)},
+		{testMultiDimensionalFixedArray, &StructWithMultiDimArray{A: [2][3][2]uint32{{{1, 2}, {3, 4}, {5, 6}}, {{7, 8}, {9, 10}, {11, 12}}}}, new(StructWithMultiDimArray)},
+		{testUniDimensionalConformantArray, &StructWithConformantSlice{A: []uint32{1, 2, 3, 4}}, new(StructWithConformantSlice)},
+		{testMultiDimensionalConformantArray, &StructWithMultiDimensionalConformantSlice{A: ar}, new(StructWithMultiDimensionalConformantSlice)},
+		{testUniDimensionalVaryingArray, &StructWithVaryingSlice{A: []uint32{1, 2, 3, 4}}, new(StructWithVaryingSlice)},
+		{testMultiDimensionalVaryingArray, &StructWithMultiDimensionalVaryingSlice{A: ar}, new(StructWithMultiDimensionalVaryingSlice)},
+		{testUniDimensionalConformantVaryingArray, &StructWithConformantVaryingSlice{A: []uint32{1, 2, 3, 4}}, new(StructWithConformantVaryingSlice)},
+		{testMultiDimensionalConformantVaryingArray, &StructWithMultiDimensionalConformantVaryingSlice{A: ar}, new(StructWithMultiDimensionalConformantVaryingSlice)},
+	}
+	for i, test := range tests {
+		enc := NewEncoder(new(bytes.Buffer), false)
+		b, err := enc.Encode(test.In)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		assert.Equal(t, test.Hex, hex.EncodeToString(b), "encoded array not as expected for test %d", i)
+
+		dec := NewDecoder(bytes.NewReader(b), false)
+		err = dec.Decode(test.Out)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		assert.Equal(t, test.In, test.Out, "array not as expected after round trip for test %d", i)
+	}
+}
+
+func TestWriteMultiDimensionalArrayNotRectangular(t *testing.T) {
+	a := StructWithMultiDimensionalConformantSlice{A: [][][]uint32{{{1, 2}}, {{1}}}}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	_, err := enc.Encode(&a)
+	if err == nil {
+		t.Errorf("expected error for multi-dimensional array with sub slices of different lengths")
+	}
+}
+
+type StructWithVaryingWindow struct {
+	First  uint32
+	Length uint32
+	A      []uint32 `ndr:"conformant,varying,first_is:First,length_is:Length"`
+}
+
+type StructWithVaryingWindowPointer struct {
+	Last uint16
+	A    []uint32 `ndr:"pointer,varying,first_is:1,last_is:Last"`
+}
+
+func TestWriteVaryingArrayWindow(t *testing.T) {
+	a := StructWithVaryingWindow{First: 2, Length: 3, A: []uint32{1, 2, 3, 4, 5, 6}}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// max:First:Length:offset:actual count:elements within the window
+	assert.Equal(t, "06000000"+"02000000"+"03000000"+"02000000"+"03000000"+"030000000400000005000000", hex.EncodeToString(b), "encoded varying array not as expected")
+
+	d := new(StructWithVaryingWindow)
+	dec := NewDecoder(bytes.NewReader(b), false)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// The slice has the length of the max count so that it is kept when encoding again
+	assert.Equal(t, []uint32{0, 0, 3, 4, 5, 0}, d.A, "decoded varying array not as expected")
+
+	enc = NewEncoder(new(bytes.Buffer), false)
+	e, err := enc.Encode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, hex.EncodeToString(b), hex.EncodeToString(e), "varying array not as expected after encoding again")
+}
+
+func TestWriteVaryingArrayWindowPointer(t *testing.T) {
+	a := StructWithVaryingWindowPointer{Last: 2, A: []uint32{1, 2, 3, 4}}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// Last:alignment:ptr:offset:actual count:elements within the window
+	assert.Equal(t, "0200"+"0000"+"00000200"+"01000000"+"02000000"+"0200000003000000", hex.EncodeToString(b), "encoded varying array not as expected")
+
+	d := new(StructWithVaryingWindowPointer)
+	dec := NewDecoder(bytes.NewReader(b), false)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, []uint32{0, 2, 3}, d.A, "decoded varying array not as expected")
+}
+
+func TestWriteVaryingArrayWindowOutOfRange(t *testing.T) {
+	a := StructWithVaryingWindow{First: 2, Length: 5, A: []uint32{1, 2, 3, 4, 5, 6}}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	_, err := enc.Encode(&a)
+	if err == nil {
+		t.Errorf("expected error for window outside of the varying array")
+	}
+}
+
+type StructWithConformantVaryingMaxCount struct {
+	A []uint32 `ndr:"conformant,varying,size_is:8"`
+}
+
+type StructWithConformantMaxCount struct {
+	Count uint32
+	A     []uint32 `ndr:"conformant,size_is:Count"`
+}
+
+func TestWriteConformantArrayMaxCount(t *testing.T) {
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&StructWithConformantVaryingMaxCount{A: []uint32{}})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// max:offset:actual count
+	assert.Equal(t, "08000000"+"00000000"+"00000000", hex.EncodeToString(b), "encoded conformant varying array not as expected")
+
+	enc = NewEncoder(new(bytes.Buffer), false)
+	b, err = enc.Encode(&StructWithConformantVaryingMaxCount{A: []uint32{1, 2}})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, "08000000"+"00000000"+"02000000"+"0100000002000000", hex.EncodeToString(b), "encoded conformant varying array not as expected")
+
+	enc = NewEncoder(new(bytes.Buffer), false)
+	_, err = enc.Encode(&StructWithConformantVaryingMaxCount{A: make([]uint32, 9)})
+	if err == nil {
+		t.Errorf("expected error when the actual count is larger than the max count")
+	}
+
+	enc = NewEncoder(new(bytes.Buffer), false)
+	_, err = enc.Encode(&StructWithConformantMaxCount{Count: 3, A: []uint32{1, 2}})
+	if err == nil {
+		t.Errorf("expected error when the max count of a conformant array does not match its length")
+	}
+}
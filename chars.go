@@ -0,0 +1,190 @@
+package ndr
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+/*
+8-bit character strings
+
+A string field tagged with "char" or "ascii" is marshalled as an IDL [string] char array with 1 octet elements rather
+than as UTF-16. The counts of the string are in octets and include the null terminator.
+
+When the character encoding of the NDR format label is EBCDIC, the octets are translated using code page 037.
+Otherwise the octets are interpreted using the selected code page, ISO-8859-1 by default.
+*/
+
+// CodePage selects how the octets of an 8-bit character string map to characters.
+type CodePage int
+
+// Supported code pages of 8-bit character strings
+const (
+	CodePageISO88591 CodePage = 28591 // ISO-8859-1, which maps each octet to the character of the same value
+	CodePage1252     CodePage = 1252  // Windows ANSI Latin 1
+	CodePage437      CodePage = 437   // OEM United States
+)
+
+// cp1252 holds the characters of octets 0x80 to 0x9F in code page 1252 which differ from ISO-8859-1. Octets that are
+// not defined by the code page map to the control character of the same value.
+var cp1252 = [32]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021, 0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014, 0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+// cp437 holds the characters of octets 0x80 to 0xFF in code page 437.
+var cp437 = [128]rune{
+	0x00C7, 0x00FC, 0x00E9, 0x00E2, 0x00E4, 0x00E0, 0x00E5, 0x00E7, 0x00EA, 0x00EB, 0x00E8, 0x00EF, 0x00EE, 0x00EC, 0x00C4, 0x00C5,
+	0x00C9, 0x00E6, 0x00C6, 0x00F4, 0x00F6, 0x00F2, 0x00FB, 0x00F9, 0x00FF, 0x00D6, 0x00DC, 0x00A2, 0x00A3, 0x00A5, 0x20A7, 0x0192,
+	0x00E1, 0x00ED, 0x00F3, 0x00FA, 0x00F1, 0x00D1, 0x00AA, 0x00BA, 0x00BF, 0x2310, 0x00AC, 0x00BD, 0x00BC, 0x00A1, 0x00AB, 0x00BB,
+	0x2591, 0x2592, 0x2593, 0x2502, 0x2524, 0x2561, 0x2562, 0x2556, 0x2555, 0x2563, 0x2551, 0x2557, 0x255D, 0x255C, 0x255B, 0x2510,
+	0x2514, 0x2534, 0x252C, 0x251C, 0x2500, 0x253C, 0x255E, 0x255F, 0x255A, 0x2554, 0x2569, 0x2566, 0x2560, 0x2550, 0x256C, 0x2567,
+	0x2568, 0x2564, 0x2565, 0x2559, 0x2558, 0x2552, 0x2553, 0x256B, 0x256A, 0x2518, 0x250C, 0x2588, 0x2584, 0x258C, 0x2590, 0x2580,
+	0x03B1, 0x00DF, 0x0393, 0x03C0, 0x03A3, 0x03C3, 0x00B5, 0x03C4, 0x03A6, 0x0398, 0x03A9, 0x03B4, 0x221E, 0x03C6, 0x03B5, 0x2229,
+	0x2261, 0x00B1, 0x2265, 0x2264, 0x2320, 0x2321, 0x00F7, 0x2248, 0x00B0, 0x2219, 0x00B7, 0x221A, 0x207F, 0x00B2, 0x25A0, 0x00A0,
+}
+
+// ebcdic037 holds the characters of all octets in the EBCDIC code page 037.
+var ebcdic037 = [256]rune{
+	0x0000, 0x0001, 0x0002, 0x0003, 0x009C, 0x0009, 0x0086, 0x007F, 0x0097, 0x008D, 0x008E, 0x000B, 0x000C, 0x000D, 0x000E, 0x000F,
+	0x0010, 0x0011, 0x0012, 0x0013, 0x009D, 0x0085, 0x0008, 0x0087, 0x0018, 0x0019, 0x0092, 0x008F, 0x001C, 0x001D, 0x001E, 0x001F,
+	0x0080, 0x0081, 0x0082, 0x0083, 0x0084, 0x000A, 0x0017, 0x001B, 0x0088, 0x0089, 0x008A, 0x008B, 0x008C, 0x0005, 0x0006, 0x0007,
+	0x0090, 0x0091, 0x0016, 0x0093, 0x0094, 0x0095, 0x0096, 0x0004, 0x0098, 0x0099, 0x009A, 0x009B, 0x0014, 0x0015, 0x009E, 0x001A,
+	0x0020, 0x00A0, 0x00E2, 0x00E4, 0x00E0, 0x00E1, 0x00E3, 0x00E5, 0x00E7, 0x00F1, 0x00A2, 0x002E, 0x003C, 0x0028, 0x002B, 0x007C,
+	0x0026, 0x00E9, 0x00EA, 0x00EB, 0x00E8, 0x00ED, 0x00EE, 0x00EF, 0x00EC, 0x00DF, 0x0021, 0x0024, 0x002A, 0x0029, 0x003B, 0x00AC,
+	0x002D, 0x002F, 0x00C2, 0x00C4, 0x00C0, 0x00C1, 0x00C3, 0x00C5, 0x00C7, 0x00D1, 0x00A6, 0x002C, 0x0025, 0x005F, 0x003E, 0x003F,
+	0x00F8, 0x00C9, 0x00CA, 0x00CB, 0x00C8, 0x00CD, 0x00CE, 0x00CF, 0x00CC, 0x0060, 0x003A, 0x0023, 0x0040, 0x0027, 0x003D, 0x0022,
+	0x00D8, 0x0061, 0x0062, 0x0063, 0x0064, 0x0065, 0x0066, 0x0067, 0x0068, 0x0069, 0x00AB, 0x00BB, 0x00F0, 0x00FD, 0x00FE, 0x00B1,
+	0x00B0, 0x006A, 0x006B, 0x006C, 0x006D, 0x006E, 0x006F, 0x0070, 0x0071, 0x0072, 0x00AA, 0x00BA, 0x00E6, 0x00B8, 0x00C6, 0x00A4,
+	0x00B5, 0x007E, 0x0073, 0x0074, 0x0075, 0x0076, 0x0077, 0x0078, 0x0079, 0x007A, 0x00A1, 0x00BF, 0x00D0, 0x00DD, 0x00DE, 0x00AE,
+	0x005E, 0x00A3, 0x00A5, 0x00B7, 0x00A9, 0x00A7, 0x00B6, 0x00BC, 0x00BD, 0x00BE, 0x005B, 0x005D, 0x00AF, 0x00A8, 0x00B4, 0x00D7,
+	0x007B, 0x0041, 0x0042, 0x0043, 0x0044, 0x0045, 0x0046, 0x0047, 0x0048, 0x0049, 0x00AD, 0x00F4, 0x00F6, 0x00F2, 0x00F3, 0x00F5,
+	0x007D, 0x004A, 0x004B, 0x004C, 0x004D, 0x004E, 0x004F, 0x0050, 0x0051, 0x0052, 0x00B9, 0x00FB, 0x00FC, 0x00F9, 0x00FA, 0x00FF,
+	0x005C, 0x00F7, 0x0053, 0x0054, 0x0055, 0x0056, 0x0057, 0x0058, 0x0059, 0x005A, 0x00B2, 0x00D4, 0x00D6, 0x00D2, 0x00D3, 0x00D5,
+	0x0030, 0x0031, 0x0032, 0x0033, 0x0034, 0x0035, 0x0036, 0x0037, 0x0038, 0x0039, 0x00B3, 0x00DB, 0x00DC, 0x00D9, 0x00DA, 0x009F,
+}
+
+// isCharString reports whether a string with the tag is an 8-bit character string.
+func isCharString(tag reflect.StructTag) bool {
+	ndrTag := parseTags(tag)
+	return ndrTag.HasValue(TagChar) || ndrTag.HasValue(TagASCII)
+}
+
+// charTable returns the characters of all octets for the character encoding and code page.
+func charTable(encoding uint8, cp CodePage) ([256]rune, error) {
+	if encoding == ebcdic {
+		return ebcdic037, nil
+	}
+	var t [256]rune
+	for i := range t {
+		t[i] = rune(i)
+	}
+	switch cp {
+	case 0, CodePageISO88591:
+	case CodePage1252:
+		copy(t[0x80:], cp1252[:])
+	case CodePage437:
+		copy(t[0x80:], cp437[:])
+	default:
+		return t, fmt.Errorf("unsupported code page %d", cp)
+	}
+	return t, nil
+}
+
+// decodeChars converts the octets of an 8-bit character string to a string, removing any null terminator.
+func decodeChars(b []byte, encoding uint8, cp CodePage) (string, error) {
+	t, err := charTable(encoding, cp)
+	if err != nil {
+		return "", err
+	}
+	s := make([]rune, len(b))
+	for i := range b {
+		s[i] = t[b[i]]
+	}
+	return strings.TrimSuffix(string(s), "\x00"), nil
+}
+
+// encodeChars converts a string to the octets of an 8-bit character string.
+func encodeChars(s string, encoding uint8, cp CodePage) ([]byte, error) {
+	t, err := charTable(encoding, cp)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[rune]byte, len(t))
+	for i := len(t) - 1; i >= 0; i-- {
+		m[t[i]] = byte(i)
+	}
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		c, ok := m[r]
+		if !ok {
+			return nil, fmt.Errorf("character %q cannot be represented in an 8-bit character string", r)
+		}
+		b = append(b, c)
+	}
+	return b, nil
+}
+
+// SetCharacterEncoding selects the character encoding of 8-bit character strings, overriding the one indicated in a
+// version 1 common header.
+func (dec *Decoder) SetCharacterEncoding(e uint8) {
+	dec.ch.CharacterEncoding = e
+	dec.charEncodingSet = true
+}
+
+// SetCodePage selects the code page of 8-bit character strings when the character encoding is ASCII.
+func (dec *Decoder) SetCodePage(cp CodePage) {
+	dec.codePage = cp
+}
+
+// SetCodePage selects the code page of 8-bit character strings when the character encoding is ASCII.
+func (enc *Encoder) SetCodePage(cp CodePage) {
+	enc.codePage = cp
+}
+
+func (dec *Decoder) readVaryingCharString(tag reflect.StructTag, def *[]deferedPtr) (string, error) {
+	a := new([]uint8)
+	err := dec.fillUniDimensionalVaryingArray(reflect.ValueOf(a).Elem(), correlationTag(tag), def)
+	if err != nil {
+		return "", err
+	}
+	return decodeChars(*a, dec.ch.CharacterEncoding, dec.codePage)
+}
+
+func (dec *Decoder) readConformantVaryingCharString(tag reflect.StructTag, def *[]deferedPtr) (string, error) {
+	a := new([]uint8)
+	err := dec.fillUniDimensionalConformantVaryingArray(reflect.ValueOf(a).Elem(), correlationTag(tag), def)
+	if err != nil {
+		return "", err
+	}
+	return decodeChars(*a, dec.ch.CharacterEncoding, dec.codePage)
+}
+
+// charCount returns the number of octets of the 8-bit character string including the null terminator.
+func (enc *Encoder) charCount(s string) (uint32, error) {
+	b, err := encodeChars(s, enc.ch.CharacterEncoding, enc.codePage)
+	if err != nil {
+		return 0, err
+	}
+	n := uint32(len(b))
+	if !strings.HasSuffix(s, "\x00") {
+		n++
+	}
+	return n, nil
+}
+
+// writeCharString writes the octets of an 8-bit character string preceded by the offset and actual count.
+// The conformant max count of a conformant string has already been written at the beginning of the structure.
+func (enc *Encoder) writeCharString(b []byte) error {
+	err := enc.writeCount(0) // offset
+	if err != nil {
+		return fmt.Errorf("could not write offset of character string: %v", err)
+	}
+	err = enc.writeCount(uint32(len(b)))
+	if err != nil {
+		return fmt.Errorf("could not write actual count of character string: %v", err)
+	}
+	_, err = enc.w.Write(b)
+	return err
+}
@@ -0,0 +1,111 @@
+package ndr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCharStrings struct {
+	A string `ndr:"conformant,char"`
+	B string `ndr:"ascii"`
+	C uint16
+}
+
+func TestCharStrings(t *testing.T) {
+	a := testCharStrings{A: "abc", B: "hi", C: 1}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// A max count:A offset:A actual count:abc\0:B offset:B actual count:hi\0:padding:C
+	assert.Equal(t, "04000000"+"00000000"+"04000000"+"61626300"+"00000000"+"03000000"+"686900"+"00"+"0100",
+		hex.EncodeToString(b), "encoded bytes not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), false)
+	d := new(testCharStrings)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "value not as expected after round trip")
+}
+
+func TestCharStringsEBCDIC(t *testing.T) {
+	a := testCharStrings{A: "ABC", B: "hi", C: 1}
+	enc := NewEncoder(new(bytes.Buffer), true)
+	enc.SetCharacterEncoding(CharacterEncodingEBCDIC)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, "11", hex.EncodeToString(b[1:2]), "endianness and character encoding not as expected in common header")
+	// The strings follow the headers and the top level referent ID
+	assert.Equal(t, "c1c2c300", hex.EncodeToString(b[32:36]), "EBCDIC bytes not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), true)
+	d := new(testCharStrings)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, CharacterEncodingEBCDIC, dec.CommonHeader().CharacterEncoding, "character encoding not as expected")
+	assert.Equal(t, a, *d, "value not as expected after round trip")
+
+	// Selecting the character encoding on the decoder overrides the header
+	dec = NewDecoder(bytes.NewReader(b), true)
+	dec.SetCharacterEncoding(CharacterEncodingASCII)
+	d = new(testCharStrings)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, "ÁÂÃ", d.A, "value not as expected with the character encoding selected")
+}
+
+func TestEBCDICTable(t *testing.T) {
+	seen := make(map[rune]bool)
+	for i, r := range ebcdic037 {
+		if r > 0xFF || seen[r] {
+			t.Fatalf("EBCDIC octet %#x does not map to a distinct Latin-1 character", i)
+		}
+		seen[r] = true
+	}
+}
+
+func TestCodePages(t *testing.T) {
+	var tests = []struct {
+		CodePage CodePage
+		Hex      string
+		Str      string
+	}{
+		{0, "e9", "é"},
+		{CodePageISO88591, "80", "\u0080"},
+		{CodePage1252, "80e9", "€é"},
+		{CodePage437, "82c9", "é╔"},
+	}
+	for i, test := range tests {
+		b, _ := hex.DecodeString(test.Hex)
+		s, err := decodeChars(b, ascii, test.CodePage)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		assert.Equal(t, test.Str, s, "string not as expected for test %d", i)
+		e, err := encodeChars(s, ascii, test.CodePage)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		assert.Equal(t, test.Hex, hex.EncodeToString(e), "bytes not as expected for test %d", i)
+	}
+	_, err := encodeChars("€", ascii, CodePageISO88591)
+	if err == nil {
+		t.Errorf("expected error for a character not in the code page")
+	}
+	_, err = decodeChars([]byte{0}, ascii, CodePage(1))
+	if err == nil {
+		t.Errorf("expected error for an unsupported code page")
+	}
+}
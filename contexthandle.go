@@ -0,0 +1,119 @@
+package ndr
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync"
+)
+
+// ContextHandle implements the 20 byte RPC context handle, such as a policy_handle, of attributes and a UUID:
+// http://pubs.opengroup.org/onlinepubs/9629399/chap14.htm#tagcjh_19_03_08
+type ContextHandle struct {
+	Attributes uint32
+	UUID       GUID
+}
+
+// IsNull reports whether the context handle is NULL, which it is when all 20 bytes are zero.
+func (h ContextHandle) IsNull() bool {
+	return h == ContextHandle{}
+}
+
+// Equal reports whether the context handles are the same.
+func (h ContextHandle) Equal(o ContextHandle) bool {
+	return h == o
+}
+
+// String returns the UUID of the context handle.
+func (h ContextHandle) String() string {
+	return h.UUID.String()
+}
+
+// RundownFunc is called with the value of a context handle when the handle is released.
+type RundownFunc func(v interface{})
+
+type handleEntry struct {
+	v       interface{}
+	rundown RundownFunc
+}
+
+// HandleTable keeps track of the context handles a server has handed out and the value, such as the server state,
+// each handle refers to. The zero value is an empty table ready to use. It is safe for concurrent use.
+type HandleTable struct {
+	mux     sync.RWMutex
+	handles map[ContextHandle]handleEntry
+}
+
+// NewHandleTable creates a new empty HandleTable.
+func NewHandleTable() *HandleTable {
+	return &HandleTable{handles: make(map[ContextHandle]handleEntry)}
+}
+
+// Allocate returns a new context handle with a random UUID that refers to the value v. The rundown function, which
+// may be nil, is called with v when the handle is released by Close or Rundown.
+func (t *HandleTable) Allocate(v interface{}, rundown RundownFunc) (ContextHandle, error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if t.handles == nil {
+		t.handles = make(map[ContextHandle]handleEntry)
+	}
+	for {
+		var h ContextHandle
+		var b [16]byte
+		_, err := rand.Read(b[:])
+		if err != nil {
+			return h, fmt.Errorf("could not generate context handle UUID: %v", err)
+		}
+		b[6] = b[6]&0x0F | 0x40 // version 4
+		b[8] = b[8]&0x3F | 0x80 // variant
+		h.UUID, _ = GUIDFromBytes(b[:])
+		if _, ok := t.handles[h]; ok || h.IsNull() {
+			continue
+		}
+		t.handles[h] = handleEntry{v: v, rundown: rundown}
+		return h, nil
+	}
+}
+
+// Lookup returns the value the context handle refers to and whether the handle is in the table.
+func (t *HandleTable) Lookup(h ContextHandle) (interface{}, bool) {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+	e, ok := t.handles[h]
+	return e.v, ok
+}
+
+// Close removes the context handle from the table and calls its rundown function.
+func (t *HandleTable) Close(h ContextHandle) error {
+	t.mux.Lock()
+	e, ok := t.handles[h]
+	delete(t.handles, h)
+	t.mux.Unlock()
+	if !ok {
+		return fmt.Errorf("context handle %v is not in the table", h)
+	}
+	if e.rundown != nil {
+		e.rundown(e.v)
+	}
+	return nil
+}
+
+// Rundown removes all context handles from the table and calls their rundown functions, as when the client
+// connection is lost.
+func (t *HandleTable) Rundown() {
+	t.mux.Lock()
+	handles := t.handles
+	t.handles = make(map[ContextHandle]handleEntry)
+	t.mux.Unlock()
+	for _, e := range handles {
+		if e.rundown != nil {
+			e.rundown(e.v)
+		}
+	}
+}
+
+// Len returns the number of context handles in the table.
+func (t *HandleTable) Len() int {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+	return len(t.handles)
+}
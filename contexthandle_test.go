@@ -0,0 +1,125 @@
+package ndr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testContextHandles struct {
+	A ContextHandle
+	B ContextHandle
+}
+
+func TestContextHandle(t *testing.T) {
+	a := testContextHandles{B: ContextHandle{Attributes: 1, UUID: MustParseGUID(testGUID)}}
+	assert.True(t, a.A.IsNull(), "context handle should be NULL")
+	assert.False(t, a.B.IsNull(), "context handle should not be NULL")
+	assert.True(t, a.B.Equal(ContextHandle{Attributes: 1, UUID: MustParseGUID(testGUID)}), "context handles should be equal")
+
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// A NULL handle:B attributes:B UUID
+	assert.Equal(t, "0000000000000000000000000000000000000000"+"01000000"+"045d888aeb1cc9119fe808002b104860",
+		hex.EncodeToString(b), "encoded bytes not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), false)
+	d := new(testContextHandles)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "value not as expected after round trip")
+}
+
+func TestHandleTable(t *testing.T) {
+	table := NewHandleTable()
+	var closed []interface{}
+	rundown := func(v interface{}) {
+		closed = append(closed, v)
+	}
+	h1, err := table.Allocate("first", rundown)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	h2, err := table.Allocate("second", rundown)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.False(t, h1.IsNull(), "allocated context handle should not be NULL")
+	assert.False(t, h1.Equal(h2), "allocated context handles should differ")
+	assert.Equal(t, 2, table.Len(), "number of handles not as expected")
+
+	v, ok := table.Lookup(h1)
+	assert.True(t, ok, "context handle should be found")
+	assert.Equal(t, "first", v, "value not as expected")
+
+	err = table.Close(h1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, []interface{}{"first"}, closed, "rundown not called as expected on close")
+	_, ok = table.Lookup(h1)
+	assert.False(t, ok, "closed context handle should not be found")
+	err = table.Close(h1)
+	if err == nil {
+		t.Errorf("expected error closing a context handle twice")
+	}
+
+	table.Rundown()
+	assert.Equal(t, []interface{}{"first", "second"}, closed, "rundown not called as expected on rundown")
+	assert.Equal(t, 0, table.Len(), "number of handles not as expected after rundown")
+}
+
+func TestHandleTableZeroValue(t *testing.T) {
+	var table HandleTable
+	_, ok := table.Lookup(ContextHandle{})
+	assert.False(t, ok, "context handle should not be found in an empty table")
+	h, err := table.Allocate("first", nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	v, ok := table.Lookup(h)
+	assert.True(t, ok, "context handle should be found")
+	assert.Equal(t, "first", v, "value not as expected")
+
+	table = HandleTable{}
+	table.Rundown()
+	_, err = table.Allocate("second", nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, 1, table.Len(), "number of handles not as expected")
+}
+
+func TestHandleTableConcurrency(t *testing.T) {
+	table := NewHandleTable()
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				h, err := table.Allocate(i, nil)
+				if err != nil {
+					t.Errorf("%v", err)
+					return
+				}
+				if v, ok := table.Lookup(h); !ok || v != i {
+					t.Errorf("context handle not found")
+				}
+				if j%2 == 0 {
+					table.Close(h)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 16*50, table.Len(), "number of handles not as expected")
+}
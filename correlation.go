@@ -0,0 +1,428 @@
+package ndr
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+/*
+Correlation attributes link the counts of a conformant and/or varying array or string to other fields of the struct
+it is embedded in, like the size_is, max_is, first_is, last_is and length_is attributes in IDL.
+The value of the tag key is either an integer or the name of an integer field in the same struct, optionally followed
+by a single arithmetic operation (+, -, * or /) with an integer:
+
+	typedef struct _RPC_UNICODE_STRING {
+	  unsigned short Length;
+	  unsigned short MaximumLength;
+	  [size_is(MaximumLength/2), length_is(Length/2)] WCHAR* Buffer;
+	} RPC_UNICODE_STRING;
+
+	type RPCUnicodeString struct {
+		Length        uint16
+		MaximumLength uint16
+		Buffer        string `ndr:"pointer,conformant,varying,skipnull,size_is:MaximumLength/2,length_is:Length/2"`
+	}
+
+When encoding, a referenced size_is, max_is or length_is field that is zero is written with the count of the array or
+string, while a field that is already set is checked against it. The counts are filled in on a copy of each struct so
+the value being encoded is not modified.
+When decoding, the counts read from the byte stream are checked against the referenced fields. Only fields that
+precede the array or string in the struct have been decoded at that point so any other fields are not checked.
+*/
+
+// windowTags are the struct tag keys that select the elements of a varying array that are transmitted.
+var windowTags = []string{TagFirstIs, TagLastIs, TagLengthIs}
+
+// fieldTags are the struct tag keys that may reference sibling fields.
+var fieldTags = append([]string{TagSizeIs, TagMaxIs}, windowTags...)
+
+// correlation is a parsed correlation tag value.
+type correlation struct {
+	field   string // name of the referenced field or empty if the value is a constant
+	value   int    // the constant value
+	op      byte   // arithmetic operation applied to the field value or zero if none
+	operand int
+}
+
+func parseCorrelation(s string) (c correlation, err error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		c.value = n
+		return c, nil
+	}
+	c.field = s
+	if i := strings.IndexAny(s, "+-*/"); i > 0 {
+		c.field, c.op = s[:i], s[i]
+		c.operand, err = strconv.Atoi(s[i+1:])
+		if err != nil {
+			return c, fmt.Errorf("invalid operand in [%s]: %v", s, err)
+		}
+		if c.op == '/' && c.operand == 0 {
+			return c, fmt.Errorf("division by zero in [%s]", s)
+		}
+	}
+	return c, nil
+}
+
+// eval returns the value of the correlation given the fields of the parent struct.
+func (c correlation) eval(parent reflect.Value) (int, error) {
+	if c.field == "" {
+		return c.value, nil
+	}
+	f, err := correlationField(parent, c.field)
+	if err != nil {
+		return 0, err
+	}
+	n := fieldInt(f)
+	switch c.op {
+	case '+':
+		n += c.operand
+	case '-':
+		n -= c.operand
+	case '*':
+		n *= c.operand
+	case '/':
+		n /= c.operand
+	}
+	return n, nil
+}
+
+// set assigns the referenced field of the parent struct the value that makes the correlation evaluate to n.
+func (c correlation) set(parent reflect.Value, n int) error {
+	if c.field == "" {
+		return nil
+	}
+	f, err := correlationField(parent, c.field)
+	if err != nil {
+		return err
+	}
+	switch c.op {
+	case '+':
+		n -= c.operand
+	case '-':
+		n += c.operand
+	case '*':
+		if n%c.operand != 0 {
+			return fmt.Errorf("%d is not a multiple of %d", n, c.operand)
+		}
+		n /= c.operand
+	case '/':
+		n *= c.operand
+	}
+	if !f.CanSet() {
+		return fmt.Errorf("field %s cannot be set", c.field)
+	}
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f.OverflowInt(int64(n)) {
+			return fmt.Errorf("value %d overflows field %s", n, c.field)
+		}
+		f.SetInt(int64(n))
+	default:
+		if n < 0 || f.OverflowUint(uint64(n)) {
+			return fmt.Errorf("value %d overflows field %s", n, c.field)
+		}
+		f.SetUint(uint64(n))
+	}
+	return nil
+}
+
+// correlationField returns the integer field with the name s in the parent struct.
+func correlationField(parent reflect.Value, s string) (reflect.Value, error) {
+	if parent.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("no struct to find field %s in", s)
+	}
+	f := parent.FieldByName(s)
+	if !f.IsValid() {
+		return f, fmt.Errorf("no field named %s", s)
+	}
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return f, nil
+	}
+	return f, fmt.Errorf("field %s is not an integer", s)
+}
+
+func fieldInt(f reflect.Value) int {
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(f.Int())
+	}
+	return int(f.Uint())
+}
+
+// resolveFieldTags replaces the correlation tag values with their values given the fields of the parent struct.
+// This keeps the counts of an array known even when the array is the referent of a deferred pointer.
+// Tag keys that reference fields with an index of limit or higher are removed as these fields have not been decoded.
+func resolveFieldTags(parent reflect.Value, tag reflect.StructTag, limit int) (reflect.StructTag, error) {
+	ndrTag := parseTags(tag)
+	var found bool
+	for _, k := range fieldTags {
+		s, ok := ndrTag.Map[k]
+		if !ok {
+			continue
+		}
+		found = true
+		c, err := parseCorrelation(s)
+		if err != nil {
+			return tag, fmt.Errorf("could not resolve %s: %v", k, err)
+		}
+		if c.field != "" && parent.Kind() == reflect.Struct {
+			if sf, ok := parent.Type().FieldByName(c.field); ok && sf.Index[0] >= limit {
+				delete(ndrTag.Map, k)
+				continue
+			}
+		}
+		n, err := c.eval(parent)
+		if err != nil {
+			return tag, fmt.Errorf("could not resolve %s: %v", k, err)
+		}
+		ndrTag.Map[k] = strconv.Itoa(n)
+	}
+	if !found {
+		return tag, nil
+	}
+	return ndrTag.StructTag(), nil
+}
+
+// correlationTag returns a struct tag with only the correlation tag keys of the tag.
+func correlationTag(tag reflect.StructTag) reflect.StructTag {
+	ndrTag := parseTags(tag)
+	t := tags{Map: make(map[string]string)}
+	for _, k := range fieldTags {
+		if s, ok := ndrTag.Map[k]; ok {
+			t.Map[k] = s
+		}
+	}
+	return t.StructTag()
+}
+
+// resolvedTagValue returns the integer value of a resolved correlation tag key.
+func resolvedTagValue(tag reflect.StructTag, key string) (n int, ok bool, err error) {
+	ndrTag := parseTags(tag)
+	s, ok := ndrTag.Map[key]
+	if !ok {
+		return 0, false, nil
+	}
+	n, err = strconv.Atoi(s)
+	if err != nil {
+		return 0, true, fmt.Errorf("invalid %s value [%s]: %v", key, s, err)
+	}
+	return n, true, nil
+}
+
+// varyingWindow returns the offset and actual count of the elements to transmit of a varying array of length n.
+// Without any first_is, last_is or length_is tag keys all of the elements are transmitted.
+func varyingWindow(tag reflect.StructTag, n int) (o, s int, err error) {
+	o, _, err = resolvedTagValue(tag, TagFirstIs)
+	if err != nil {
+		return 0, 0, err
+	}
+	if l, ok, err := resolvedTagValue(tag, TagLengthIs); err != nil {
+		return 0, 0, err
+	} else if ok {
+		s = l
+	} else if last, ok, err := resolvedTagValue(tag, TagLastIs); err != nil {
+		return 0, 0, err
+	} else if ok {
+		// last_is is the index of the last element transmitted
+		s = last - o + 1
+		if s < 0 {
+			s = 0
+		}
+	} else {
+		s = n - o
+	}
+	if o < 0 || s < 0 || o+s > n {
+		return 0, 0, fmt.Errorf("offset %d and actual count %d is outside of the array of length %d", o, s, n)
+	}
+	return o, s, nil
+}
+
+// sizeFromTag returns the conformant max count given by the size_is or max_is tag keys or n if there is no such key.
+func sizeFromTag(tag reflect.StructTag, n int) (int, error) {
+	if size, ok, err := resolvedTagValue(tag, TagSizeIs); err != nil || ok {
+		return size, err
+	}
+	if m, ok, err := resolvedTagValue(tag, TagMaxIs); err != nil || ok {
+		// max_is is the highest index of the array
+		return m + 1, err
+	}
+	return n, nil
+}
+
+// hasSize reports whether the max count of an array is given by either a size_is or max_is tag key.
+func hasSize(tag reflect.StructTag) bool {
+	ndrTag := parseTags(tag)
+	_, size := ndrTag.Map[TagSizeIs]
+	_, max := ndrTag.Map[TagMaxIs]
+	return size || max
+}
+
+// checkCounts returns an error if the max count m, offset o or actual count s read from the byte stream does not match
+// the resolved correlation tag keys. A negative value is not checked.
+func checkCounts(tag reflect.StructTag, m, o, s int) error {
+	if m >= 0 && hasSize(tag) {
+		size, err := sizeFromTag(tag, m)
+		if err != nil {
+			return err
+		}
+		if size != m {
+			return fmt.Errorf("max count %d does not match the expected %d", m, size)
+		}
+	}
+	if o < 0 || s < 0 {
+		return nil
+	}
+	if first, ok, err := resolvedTagValue(tag, TagFirstIs); err != nil {
+		return err
+	} else if ok && first != o {
+		return fmt.Errorf("offset %d does not match the expected %d", o, first)
+	}
+	if l, ok, err := resolvedTagValue(tag, TagLengthIs); err != nil {
+		return err
+	} else if ok && l != s {
+		return fmt.Errorf("actual count %d does not match the expected %d", s, l)
+	}
+	if last, ok, err := resolvedTagValue(tag, TagLastIs); err != nil {
+		return err
+	} else if ok && s > 0 && last != o+s-1 {
+		return fmt.Errorf("last index %d does not match the expected %d", o+s-1, last)
+	}
+	return nil
+}
+
+// withCorrelationFields returns the struct v with the fields referenced by the size_is, max_is and length_is tag keys
+// of its fields filled in. The fields are filled in on a copy so that the value being encoded is not modified and
+// need not be addressable. If no field references another the struct is returned as is.
+func (enc *Encoder) withCorrelationFields(v reflect.Value) (reflect.Value, error) {
+	var c reflect.Value
+	for i := 0; i < v.NumField(); i++ {
+		ndrTag := parseTags(v.Type().Field(i).Tag)
+		_, sizeIs := ndrTag.Map[TagSizeIs]
+		_, maxIs := ndrTag.Map[TagMaxIs]
+		_, lengthIs := ndrTag.Map[TagLengthIs]
+		if !sizeIs && !maxIs && !lengthIs {
+			continue
+		}
+		if !c.IsValid() {
+			c = reflect.New(v.Type()).Elem()
+			c.Set(v)
+		}
+		err := enc.fillCorrelationFields(c, i)
+		if err != nil {
+			return v, fmt.Errorf("could not process struct field(%s): %v", v.Type().Field(i).Name, err)
+		}
+	}
+	if !c.IsValid() {
+		return v, nil
+	}
+	return c, nil
+}
+
+// fillCorrelationFields fills in the fields referenced by the size_is, max_is and length_is tag keys of the field with
+// index i of the parent struct from the length of that field, unless the referenced fields are already set. Strings are
+// counted in octets if they are 8-bit character strings and otherwise in UTF-16 code units.
+func (enc *Encoder) fillCorrelationFields(parent reflect.Value, i int) error {
+	ndrTag := parseTags(parent.Type().Field(i).Tag)
+	_, sizeIs := ndrTag.Map[TagSizeIs]
+	_, maxIs := ndrTag.Map[TagMaxIs]
+	_, lengthIs := ndrTag.Map[TagLengthIs]
+	if !sizeIs && !maxIs && !lengthIs {
+		return nil
+	}
+	f := parent.Field(i)
+	if f.Kind() == reflect.Pointer {
+		if f.IsNil() {
+			return nil
+		}
+		f = f.Elem()
+	}
+	var count, size int // actual count and the least max count
+	switch f.Kind() {
+	case reflect.String:
+		n, err := enc.countString(f.String(), parent.Type().Field(i).Tag)
+		if err != nil {
+			return err
+		}
+		count = int(n)
+		if ndrTag.HasValue(TagSkipNull) && !strings.HasSuffix(f.String(), "\x00") {
+			count--
+		}
+		size = count
+	case reflect.Slice:
+		if d, _ := sliceDimensions(f.Type()); d > 1 {
+			return nil
+		}
+		if isUnitString(f, parent.Type().Field(i).Tag) {
+			count = len(unitString(f, ndrTag.HasValue(TagSkipNull)))
+			size = count
+			break
+		}
+		var o int
+		if s, ok := ndrTag.Map[TagFirstIs]; ok {
+			c, err := parseCorrelation(s)
+			if err != nil {
+				return err
+			}
+			o, err = c.eval(parent)
+			if err != nil {
+				return err
+			}
+		}
+		count = f.Len() - o
+		size = f.Len()
+	default:
+		return nil
+	}
+
+	if lengthIs {
+		c, err := parseCorrelation(ndrTag.Map[TagLengthIs])
+		if err != nil {
+			return err
+		}
+		if c.field != "" {
+			cf, err := correlationField(parent, c.field)
+			if err != nil {
+				return err
+			}
+			if cf.IsZero() {
+				err = c.set(parent, count)
+				if err != nil {
+					return fmt.Errorf("could not set %s: %v", TagLengthIs, err)
+				}
+			}
+		}
+	}
+	for _, k := range []string{TagSizeIs, TagMaxIs} {
+		s, ok := ndrTag.Map[k]
+		if !ok {
+			continue
+		}
+		c, err := parseCorrelation(s)
+		if err != nil {
+			return err
+		}
+		if c.field == "" {
+			continue
+		}
+		cf, err := correlationField(parent, c.field)
+		if err != nil {
+			return err
+		}
+		if !cf.IsZero() {
+			continue
+		}
+		n := size
+		if k == TagMaxIs {
+			n--
+		}
+		err = c.set(parent, n)
+		if err != nil {
+			return fmt.Errorf("could not set %s: %v", k, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package ndr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testRPCSID struct {
+	Revision            uint8
+	SubAuthorityCount   uint8
+	IdentifierAuthority [6]byte
+	SubAuthority        []uint32 `ndr:"conformant,size_is:SubAuthorityCount"`
+}
+
+type testRPCUnicodeString struct {
+	Length        uint16
+	MaximumLength uint16
+	Buffer        string `ndr:"pointer,conformant,varying,skipnull,size_is:MaximumLength/2,length_is:Length/2"`
+}
+
+type testANSIString struct {
+	Length        uint16
+	MaximumLength uint16
+	Buffer        string `ndr:"pointer,conformant,varying,skipnull,char,size_is:MaximumLength,length_is:Length"`
+}
+
+type testMaxIs struct {
+	Max uint32
+	A   []uint16 `ndr:"conformant,max_is:Max"`
+}
+
+type testRPCUnicodeStrings struct {
+	Count uint32
+	Names []testRPCUnicodeString `ndr:"pointer,conformant,size_is:Count"`
+}
+
+const testSIDHex = "02000000" + "0102000000000005" + "2000000020020000" // max:Revision:SubAuthorityCount:IdentifierAuthority:SubAuthority
+
+func TestParseCorrelation(t *testing.T) {
+	var tests = []struct {
+		s string
+		c correlation
+	}{
+		{"3", correlation{value: 3}},
+		{"Count", correlation{field: "Count"}},
+		{"Length/2", correlation{field: "Length", op: '/', operand: 2}},
+		{"Max+1", correlation{field: "Max", op: '+', operand: 1}},
+		{"Count*4", correlation{field: "Count", op: '*', operand: 4}},
+		{"Count-1", correlation{field: "Count", op: '-', operand: 1}},
+	}
+	for i, test := range tests {
+		c, err := parseCorrelation(test.s)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		assert.Equal(t, test.c, c, "correlation not as expected for test %d", i)
+	}
+	_, err := parseCorrelation("Length/0")
+	if err == nil {
+		t.Errorf("expected error for division by zero")
+	}
+}
+
+func TestWriteSizeIsField(t *testing.T) {
+	a := testRPCSID{Revision: 1, IdentifierAuthority: [6]byte{0, 0, 0, 0, 0, 5}, SubAuthority: []uint32{32, 544}}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, testSIDHex, hex.EncodeToString(b), "encoded SID not as expected")
+	assert.Equal(t, uint8(0), a.SubAuthorityCount, "SubAuthorityCount of the encoded value was modified")
+
+	d := new(testRPCSID)
+	dec := NewDecoder(bytes.NewReader(b), false)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	a.SubAuthorityCount = 2
+	assert.Equal(t, a, *d, "SID not as expected after round trip")
+
+	a.SubAuthorityCount = 3
+	enc = NewEncoder(new(bytes.Buffer), false)
+	_, err = enc.Encode(&a)
+	if err == nil {
+		t.Errorf("expected error when SubAuthorityCount does not match the number of sub authorities")
+	}
+}
+
+func TestReadSizeIsFieldMismatch(t *testing.T) {
+	b, _ := hex.DecodeString("02000000" + "0103000000000005" + "2000000020020000")
+	d := new(testRPCSID)
+	dec := NewDecoder(bytes.NewReader(b), false)
+	err := dec.Decode(d)
+	if err == nil {
+		t.Errorf("expected error when the max count does not match SubAuthorityCount")
+	}
+}
+
+func TestWriteUnicodeStringCorrelation(t *testing.T) {
+	var tests = []struct {
+		In  testRPCUnicodeString
+		Out testRPCUnicodeString
+		Hex string
+	}{
+		{
+			testRPCUnicodeString{Buffer: "ab"},
+			testRPCUnicodeString{Length: 4, MaximumLength: 4, Buffer: "ab"},
+			"0400" + "0400" + "00000200" + "02000000" + "00000000" + "02000000" + "61006200",
+		},
+		{
+			testRPCUnicodeString{MaximumLength: 10, Buffer: "ab"},
+			testRPCUnicodeString{Length: 4, MaximumLength: 10, Buffer: "ab"},
+			"0400" + "0a00" + "00000200" + "05000000" + "00000000" + "02000000" + "61006200",
+		},
+	}
+	for i, test := range tests {
+		in := test.In
+		enc := NewEncoder(new(bytes.Buffer), false)
+		b, err := enc.Encode(&in)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		assert.Equal(t, test.Hex, hex.EncodeToString(b), "encoded string not as expected for test %d", i)
+		assert.Equal(t, test.In, in, "encoded value was modified for test %d", i)
+
+		d := new(testRPCUnicodeString)
+		dec := NewDecoder(bytes.NewReader(b), false)
+		err = dec.Decode(d)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		assert.Equal(t, test.Out, *d, "string not as expected after round trip for test %d", i)
+	}
+
+	enc := NewEncoder(new(bytes.Buffer), false)
+	_, err := enc.Encode(&testRPCUnicodeString{Length: 6, Buffer: "ab"})
+	if err == nil {
+		t.Errorf("expected error when Length does not match the string")
+	}
+}
+
+func TestWriteUnicodeStringArrayCorrelation(t *testing.T) {
+	a := testRPCUnicodeStrings{Names: []testRPCUnicodeString{{Buffer: "ab"}, {Buffer: "cde"}}}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// Count:Names pointer:max count:Names[0] Length:MaximumLength:Buffer pointer:Names[1]:Names[0] Buffer:Names[1] Buffer:padding
+	assert.Equal(t, "02000000"+"00000200"+"02000000"+"0400"+"0400"+"04000200"+"0600"+"0600"+"08000200"+
+		"02000000"+"00000000"+"02000000"+"61006200"+"03000000"+"00000000"+"03000000"+"630064006500"+"0000",
+		hex.EncodeToString(b), "encoded strings not as expected")
+
+	d := new(testRPCUnicodeStrings)
+	dec := NewDecoder(bytes.NewReader(b), false)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	e := testRPCUnicodeStrings{Count: 2, Names: []testRPCUnicodeString{
+		{Length: 4, MaximumLength: 4, Buffer: "ab"},
+		{Length: 6, MaximumLength: 6, Buffer: "cde"},
+	}}
+	assert.Equal(t, e, *d, "strings not as expected after round trip")
+}
+
+func TestWriteCorrelationNotAddressable(t *testing.T) {
+	a := testRPCSID{Revision: 1, IdentifierAuthority: [6]byte{0, 0, 0, 0, 0, 5}, SubAuthority: []uint32{32, 544}}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(reflect.ValueOf(a))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, testSIDHex, hex.EncodeToString(b), "encoded SID not as expected")
+}
+
+func TestWriteCharStringCorrelation(t *testing.T) {
+	a := testANSIString{Buffer: "café"}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	enc.SetCodePage(CodePage1252)
+	// 8-bit character strings are not converted to UTF-16
+	enc.SetUTF16Policy(UTF16Strict)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// Length:MaximumLength:Buffer pointer:max count:offset:actual count:octets
+	assert.Equal(t, "0400"+"0400"+"00000200"+"04000000"+"00000000"+"04000000"+"636166e9", hex.EncodeToString(b),
+		"encoded string not as expected")
+
+	d := new(testANSIString)
+	dec := NewDecoder(bytes.NewReader(b), false)
+	dec.SetCodePage(CodePage1252)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, testANSIString{Length: 4, MaximumLength: 4, Buffer: "café"}, *d, "string not as expected after round trip")
+}
+
+func TestReadUnicodeStringCorrelationMismatch(t *testing.T) {
+	// Length of 6 bytes but an actual count of 2
+	b, _ := hex.DecodeString("0600" + "0a00" + "00000200" + "05000000" + "00000000" + "02000000" + "61006200")
+	d := new(testRPCUnicodeString)
+	dec := NewDecoder(bytes.NewReader(b), false)
+	err := dec.Decode(d)
+	if err == nil {
+		t.Errorf("expected error when the actual count does not match Length")
+	}
+}
+
+func TestWriteMaxIsField(t *testing.T) {
+	a := testMaxIs{A: []uint16{1, 2, 3}}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// max count:Max:A
+	assert.Equal(t, "03000000"+"02000000"+"010002000300", hex.EncodeToString(b), "encoded array not as expected")
+
+	d := new(testMaxIs)
+	dec := NewDecoder(bytes.NewReader(b), false)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, testMaxIs{Max: 2, A: a.A}, *d, "array not as expected after round trip")
+}
@@ -19,24 +19,45 @@ const (
 	TagFullPointer     = "fullpointer"
 	TagPipe            = "pipe"
 	TagSkipNull        = "skipnull"
+	TagSizeIs          = "size_is"
+	TagMaxIs           = "max_is"
+	TagFirstIs         = "first_is"
+	TagLastIs          = "last_is"
+	TagLengthIs        = "length_is"
+	TagElement         = "elem"
+	TagEnum            = "enum"
+	TagV1Enum          = "v1_enum"
+	TagInt3264         = "int3264"
+	TagChar            = "char"
+	TagASCII           = "ascii"
+	TagString          = "string"
+	TagFixed           = "fixed"
 )
 
 // Decoder unmarshals NDR byte stream data into a Go struct representation
 type Decoder struct {
-	r             *bufio.Reader // source of the data
-	size          int           // initial size of bytes in buffer
-	ch            CommonHeader  // NDR common header
-	ph            PrivateHeader // NDR private header
-	conformantMax []uint32      // conformant max values that were moved to the beginning of the structure
-	s             interface{}   // pointer to the structure being populated
-	current       []string      // keeps track of the current field being populated
-	includeHeader bool
+	r               *bufio.Reader // source of the data
+	size            int           // initial size of bytes in buffer
+	ch              CommonHeader  // NDR common header
+	ph              PrivateHeader // NDR private header
+	conformantMax   []uint32      // conformant max values that were moved to the beginning of the structure
+	s               interface{}   // pointer to the structure being populated
+	current         []string      // keeps track of the current field being populated
+	includeHeader   bool
+	referents       map[uint64]reflect.Value // Go pointers of the full pointer referents read
+	nilPointers     bool                     // leave Go pointers of NULL pointers nil
+	depth           int                      // current nesting depth of deferred referents
+	maxDepth        int                      // max nesting depth of deferred referents. Zero or less means no limit
+	ndr64           bool                     // the byte stream uses the NDR64 transfer syntax
+	codePage        CodePage                 // code page of 8-bit character strings
+	charEncodingSet bool                     // the character encoding was selected rather than read from the header
+	utf16Policy     UTF16Policy              // handling of unpaired surrogates in UTF-16 strings
 }
 
 type deferedPtr struct {
 	v   reflect.Value
 	tag reflect.StructTag
-	p   uint32
+	p   uint64
 }
 
 // NewDecoder creates a new instance of a NDR Decoder.
@@ -46,12 +67,16 @@ func NewDecoder(r io.Reader, includeHeader bool) *Decoder {
 	dec.r.Peek(int(commonHeaderBytes)) // For some reason an operation is needed on the buffer to initialise it so Buffered() != 0
 	dec.size = dec.r.Buffered()
 	dec.includeHeader = includeHeader
+	dec.referents = make(map[uint64]reflect.Value)
+	dec.maxDepth = defaultMaxDepth
 	return dec
 }
 
 // Decode unmarshals the NDR encoded bytes into the pointer of a struct provided.
 func (dec *Decoder) Decode(s interface{}) error {
 	dec.s = s
+	// Full pointers are scoped to a single message
+	dec.referents = make(map[uint64]reflect.Value)
 	if dec.includeHeader {
 		err := dec.readCommonHeader()
 		if err != nil {
@@ -61,7 +86,7 @@ func (dec *Decoder) Decode(s interface{}) error {
 		if err != nil {
 			return err
 		}
-		_, err = dec.r.Discard(4) //The next 4 bytes are an RPC unique pointer referent. We just skip these.
+		_, err = dec.readPointer() //The next bytes are an RPC unique pointer referent. We just skip these.
 		if err != nil {
 			return Errorf("unable to process byte stream: %v", err)
 		}
@@ -77,6 +102,28 @@ func (dec *Decoder) SetEndianness(order binary.ByteOrder) {
 	dec.ch.Endianness = order
 }
 
+// SetNilPointers selects whether a Go pointer field tagged as a pointer is left nil when the NDR pointer is NULL.
+// By default such a field is set to a pointer to a zero value so a NULL pointer cannot be told from an empty referent.
+func (dec *Decoder) SetNilPointers(b bool) {
+	dec.nilPointers = b
+}
+
+// SetMaxDepth sets the max nesting depth of deferred referents, such as the nodes of a linked list, to protect
+// against unbounded recursion on hostile input. A depth of zero or less removes the limit.
+func (dec *Decoder) SetMaxDepth(n int) {
+	dec.maxDepth = n
+}
+
+// CommonHeader returns the NDR common header read from the byte stream.
+func (dec *Decoder) CommonHeader() CommonHeader {
+	return dec.ch
+}
+
+// PrivateHeader returns the NDR private header read from the byte stream.
+func (dec *Decoder) PrivateHeader() PrivateHeader {
+	return dec.ph
+}
+
 func (dec *Decoder) process(s interface{}, tag reflect.StructTag) error {
 	// Scan for conformant fields as their max counts are moved to the beginning
 	// http://pubs.opengroup.org/onlinepubs/9629399/chap14.htm#tagfcjh_37
@@ -93,9 +140,19 @@ func (dec *Decoder) process(s interface{}, tag reflect.StructTag) error {
 		return Errorf("could not decode: %v", err)
 	}
 	// Read any deferred referents associated with pointers
-	for _, p := range localDef {
+	return dec.processDeferred(localDef)
+}
+
+// processDeferred reads the deferred referents of the pointers in def in order.
+func (dec *Decoder) processDeferred(def []deferedPtr) error {
+	for _, p := range def {
 		//fmt.Printf("Processing deferred struct: %+v, ptr: %x\n", p, p.p)
-		err = dec.process(p.v, p.tag)
+		dec.depth++
+		if dec.maxDepth > 0 && dec.depth > dec.maxDepth {
+			return fmt.Errorf("deferred referents nested deeper than the max depth of %d", dec.maxDepth)
+		}
+		err := dec.process(p.v, p.tag)
+		dec.depth--
 		if err != nil {
 			return fmt.Errorf("could not decode deferred referent: %v", err)
 		}
@@ -112,7 +169,7 @@ func (dec *Decoder) scanConformantArrays(s interface{}, tag reflect.StructTag) e
 	}
 	//fmt.Printf("Found %d conformant Max values for tag: %v, field: %v\n", len(dec.conformantMax), tag, dec.current)
 	for i := range dec.conformantMax {
-		dec.conformantMax[i], err = dec.readUint32()
+		dec.conformantMax[i], err = dec.readCount()
 		//fmt.Printf("Conformant max: %d for field: %v\n", dec.conformantMax[i], dec.current)
 		if err != nil {
 			return fmt.Errorf("could not read preceding conformant max count index %d: %v", i, err)
@@ -133,10 +190,7 @@ func (dec *Decoder) conformantScan(s interface{}, tag reflect.StructTag) error {
 	case reflect.Struct:
 		for i := 0; i < v.NumField(); i++ {
 			// Handle edge case where uninitialized struct (nil ptr) contains a conformant array
-			if v.Field(i).Kind() == reflect.Pointer && v.Field(i).IsNil() {
-				// Handle when struct pointer is nil
-				v.Field(i).Set(reflect.New(v.Field(i).Type().Elem()))
-			}
+			dec.allocField(v.Field(i), v.Type().Field(i).Tag)
 
 			err := dec.conformantScan(v.Field(i), v.Type().Field(i).Tag)
 			if err != nil {
@@ -144,7 +198,7 @@ func (dec *Decoder) conformantScan(s interface{}, tag reflect.StructTag) error {
 			}
 		}
 	case reflect.String:
-		if !ndrTag.HasValue(TagConformant) {
+		if !ndrTag.HasValue(TagConformant) || isFixedString(tag) {
 			break
 		}
 		dec.conformantMax = append(dec.conformantMax, uint32(0))
@@ -157,25 +211,30 @@ func (dec *Decoder) conformantScan(s interface{}, tag reflect.StructTag) error {
 			dec.conformantMax = append(dec.conformantMax, uint32(0))
 		}
 		// For string arrays there is a common max for the strings within the array.
-		if t.Kind() == reflect.String {
+		if t.Kind() == reflect.String && !isElementPointer(tag) {
 			dec.conformantMax = append(dec.conformantMax, uint32(0))
 		}
 	}
 	return nil
 }
 
-func (dec *Decoder) isPointer(v reflect.Value, tag reflect.StructTag, def *[]deferedPtr) (bool, error) {
+func (dec *Decoder) isPointer(s interface{}, tag reflect.StructTag, def *[]deferedPtr) (bool, error) {
 	// Pointer so defer filling the referent
 	ndrTag := parseTags(tag)
 	if ndrTag.HasValue(TagPointer) {
-		p, err := dec.readUint32()
+		p, err := dec.readPointer()
 		if err != nil {
 			return true, fmt.Errorf("could not read pointer: %v", err)
 		}
 		ndrTag.delete(TagPointer)
+		r, ok := s.(reflect.Value)
+		if ok && r.Kind() == reflect.Pointer && r.IsNil() && (p != 0 || !(dec.nilPointers || isRecursive(r.Type()))) {
+			// Go pointers that are not fields, such as the inner pointer of a double pointer, are allocated here
+			r.Set(reflect.New(r.Type().Elem()))
+		}
 		if p != 0 {
 			// if pointer is not zero add to the deferred items at end of stream
-			*def = append(*def, deferedPtr{v, ndrTag.StructTag(), p})
+			*def = append(*def, deferedPtr{getReflectValue(s), ndrTag.StructTag(), p})
 		}
 		//fmt.Printf("Found ptr: 0x%08x\n", p)
 		return true, nil
@@ -183,6 +242,23 @@ func (dec *Decoder) isPointer(v reflect.Value, tag reflect.StructTag, def *[]def
 	return false, nil
 }
 
+// allocField sets a nil Go pointer field to a pointer to a zero value so that it can be filled. Fields tagged as a
+// pointer are left nil when NULL pointers are decoded as nil and are only allocated once a referent is found.
+func (dec *Decoder) allocField(f reflect.Value, tag reflect.StructTag) {
+	if f.Kind() != reflect.Pointer || !f.IsNil() {
+		return
+	}
+	ndrTag := parseTags(tag)
+	if ndrTag.HasValue(TagPointer) && !ndrTag.HasValue(TagTopLevelPointer) {
+		// A top-level reference pointer is never NULL so only the pointers it points to may be left nil.
+		// Allocating a pointer to a recursive type would add a node, such as after the tail of a linked list.
+		if dec.nilPointers || isRecursive(f.Type()) {
+			return
+		}
+	}
+	f.Set(reflect.New(f.Type().Elem()))
+}
+
 func getReflectValue(s interface{}) (v reflect.Value) {
 	if r, ok := s.(reflect.Value); ok {
 		if r.Kind() == reflect.Pointer {
@@ -214,12 +290,15 @@ func (dec *Decoder) fill(s interface{}, tag reflect.StructTag, localDef *[]defer
 		if ndrTag.HasValue(TagFullPointer) {
 			ndrTag.delete(TagFullPointer)
 			//fmt.Printf("reading top-level ptr for field: %v\n", v.Type().Name())
-			p, err := dec.readUint32()
+			p, err := dec.readPointer()
 			if err != nil {
 				return fmt.Errorf("could not read pointer: %v", err)
 			}
 			if p == 0 {
 				// Top-Level null pointer so nothing else to read here
+				if r, ok := s.(reflect.Value); ok && r.Kind() == reflect.Pointer && dec.nilPointers {
+					r.Set(reflect.Zero(r.Type()))
+				}
 				return nil
 			}
 			//fmt.Printf("[debug] full ptr value: 0x%08x\n", p)
@@ -234,14 +313,24 @@ func (dec *Decoder) fill(s interface{}, tag reflect.StructTag, localDef *[]defer
 		return nil
 	}
 
+	// Full pointers may alias a referent that has already been read
+	ptr, err := dec.isFullPointer(s, tag, localDef)
+	if err != nil {
+		return fmt.Errorf("could not process struct field(%s): %v", strings.Join(dec.current, "/"), err)
+	}
+	if ptr {
+		return nil
+	}
+
 	// Pointer so defer filling the referent
-	ptr, err := dec.isPointer(v, tag, localDef)
+	ptr, err = dec.isPointer(s, tag, localDef)
 	if err != nil {
 		return fmt.Errorf("could not process struct field(%s): %v", strings.Join(dec.current, "/"), err)
 	}
 	if ptr {
 		return nil
 	}
+
 	/*
 		A bit complex to handle pointers:
 		By default, IDL top-level pointers are [ref] pointers unless there is the [unique] or [ptr] attribute, where top-level means part of the RPC function argument list.
@@ -255,10 +344,32 @@ func (dec *Decoder) fill(s interface{}, tag reflect.StructTag, localDef *[]defer
 		If this is a [unique] pointer (full] we first write a ptr representation, followed by the second ptr representation, followed by the referent.
 	*/
 
+	// Integers with a size on the wire that differs between NDR and NDR64
+	if ndrTag.HasValue(TagEnum) || ndrTag.HasValue(TagV1Enum) {
+		err := dec.fillEnum(v, tag)
+		if err != nil {
+			return fmt.Errorf("could not fill enum struct field(%s): %v", strings.Join(dec.current, "/"), err)
+		}
+		return nil
+	}
+	if ndrTag.HasValue(TagInt3264) {
+		err := dec.fillInt3264(v)
+		if err != nil {
+			return fmt.Errorf("could not fill int3264 struct field(%s): %v", strings.Join(dec.current, "/"), err)
+		}
+		return nil
+	}
+
 	// Populate the value from the byte stream
 	switch v.Kind() {
 	case reflect.Struct:
 		//fmt.Println("examining struct")
+		// In NDR64 a structure is aligned to the largest alignment of its members and padded at the end to a multiple of it
+		var align int
+		if dec.ndr64 {
+			align = ndr64Alignment(v.Type(), reflect.StructTag(""))
+			dec.ensureAlignment(align)
+		}
 		dec.current = append(dec.current, v.Type().Name()) //Track the current field being filled
 		// in case struct is a union, track this and the selected union field for efficiency
 		var unionTag reflect.Value
@@ -271,10 +382,7 @@ func (dec *Decoder) fill(s interface{}, tag reflect.StructTag, localDef *[]defer
 			structTag := v.Type().Field(i).Tag
 			ndrTag := parseTags(structTag)
 			//fmt.Printf("Handling field: %s\n", fieldName)
-			if v.Field(i).Kind() == reflect.Pointer && v.Field(i).IsNil() {
-				// Handle when struct pointer is nil
-				v.Field(i).Set(reflect.New(v.Field(i).Type().Elem()))
-			}
+			dec.allocField(v.Field(i), structTag)
 
 			// Union handling
 			if !unionTag.IsValid() {
@@ -294,6 +402,18 @@ func (dec *Decoder) fill(s interface{}, tag reflect.StructTag, localDef *[]defer
 					dec.current = dec.current[:len(dec.current)-1] //This field has been skipped so remove it from the current field tracker
 					continue
 				}
+				if dec.ndr64 && fieldName == unionField {
+					// In NDR64 the selected arm is aligned to the largest alignment of all the arms
+					// while in NDR each arm is aligned by its own type like any other member, see Unions in
+					// http://pubs.opengroup.org/onlinepubs/9629399/chap14.htm
+					dec.ensureAlignment(unionArmAlignment(v.Type()))
+				}
+			}
+
+			// Resolve the sibling fields with the counts of an array. Only the preceding fields have been decoded.
+			structTag, err = resolveFieldTags(v, structTag, i)
+			if err != nil {
+				return fmt.Errorf("could not process struct field(%s): %v", strings.Join(dec.current, "/"), err)
 			}
 
 			// Check if field is a pointer
@@ -323,6 +443,9 @@ func (dec *Decoder) fill(s interface{}, tag reflect.StructTag, localDef *[]defer
 			}
 			dec.current = dec.current[:len(dec.current)-1] //This field has been filled so remove it from the current field tracker
 		}
+		if dec.ndr64 {
+			dec.ensureAlignment(align)
+		}
 		dec.current = dec.current[:len(dec.current)-1] //This field has been filled so remove it from the current field tracker
 	case reflect.Bool:
 		i, err := dec.readBool()
@@ -384,13 +507,27 @@ func (dec *Decoder) fill(s interface{}, tag reflect.StructTag, localDef *[]defer
 		// strings are always varying so this is assumed without an explicit tag
 		var s string
 		var err error
-		if conformant {
-			s, err = dec.readConformantVaryingString(localDef)
+		if isFixedString(tag) {
+			s, err = dec.readFixedString(tag, localDef)
+			if err != nil {
+				return fmt.Errorf("could not fill with fixed string: %v", err)
+			}
+		} else if isCharString(tag) {
+			if conformant {
+				s, err = dec.readConformantVaryingCharString(tag, localDef)
+			} else {
+				s, err = dec.readVaryingCharString(tag, localDef)
+			}
+			if err != nil {
+				return fmt.Errorf("could not fill with character string: %v", err)
+			}
+		} else if conformant {
+			s, err = dec.readConformantVaryingString(tag, localDef)
 			if err != nil {
 				return fmt.Errorf("could not fill with conformant varying string: %v", err)
 			}
 		} else {
-			s, err = dec.readVaryingString(localDef)
+			s, err = dec.readVaryingString(tag, localDef)
 			if err != nil {
 				return fmt.Errorf("could not fill with varying string: %v", err)
 			}
@@ -432,8 +569,15 @@ func (dec *Decoder) fill(s interface{}, tag reflect.StructTag, localDef *[]defer
 			}
 			break
 		}
+		if isUnitString(v, tag) {
+			err := dec.fillUnitString(v, tag, localDef)
+			if err != nil {
+				return err
+			}
+			break
+		}
 		_, t := sliceDimensions(v.Type())
-		if t.Kind() == reflect.String && !ndrTag.HasValue(subStringArrayValue) {
+		if t.Kind() == reflect.String && !ndrTag.HasValue(subStringArrayValue) && !isElementPointer(tag) {
 			// String array
 			err := dec.readStringsArray(v, tag, localDef)
 			if err != nil {
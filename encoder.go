@@ -18,6 +18,13 @@ type Encoder struct {
 	current        []string      // keeps track of the current field being populated
 	nextReferentID uint32
 	includeHeaders bool
+	pipeChunkSize  int                    // max number of elements in each chunk of a pipe. Zero means a single chunk
+	referents      map[referentKey]uint32 // referent IDs of the full pointers written
+	depth          int                    // current nesting depth of deferred referents
+	maxDepth       int                    // max nesting depth of deferred referents. Zero or less means no limit
+	ndr64          bool                   // encode using the NDR64 transfer syntax
+	codePage       CodePage               // code page of 8-bit character strings
+	utf16Policy    UTF16Policy            // handling of invalid sequences in UTF-16 strings
 }
 
 // NewDecoder creates a new instance of a NDR Decoder.
@@ -26,7 +33,10 @@ func NewEncoder(w *bytes.Buffer, includeHeaders bool) *Encoder {
 	enc.w = w
 	enc.nextReferentID = 0x00020000
 	enc.ch.Endianness = binary.LittleEndian
+	enc.ch.Version = protocolVersion
 	enc.includeHeaders = includeHeaders
+	enc.referents = make(map[referentKey]uint32)
+	enc.maxDepth = defaultMaxDepth
 	return enc
 }
 
@@ -37,9 +47,12 @@ func (enc *Encoder) GetBytes() []byte {
 // Encode marshals the provided structure into NDR encoded bytes.
 func (enc *Encoder) Encode(s interface{}) (buf []byte, err error) {
 	enc.s = s
+	// Full pointers are scoped to a single message
+	enc.referents = make(map[referentKey]uint32)
+	enc.nextReferentID = 0x00020000
 	if enc.includeHeaders {
-		//First write an NDR ptr
-		err = binary.Write(enc.w, binary.LittleEndian, uint32(0xFFFFFFFF))
+		//First write an NDR ptr as the serialized type is the referent of a top-level unique pointer
+		err = enc.writePointer()
 		if err != nil {
 			return
 		}
@@ -71,6 +84,38 @@ func (enc *Encoder) SetEndianness(order binary.ByteOrder) {
 	enc.ch.Endianness = order
 }
 
+// SetCharacterEncoding selects the character encoding indicated in the version 1 common header.
+func (enc *Encoder) SetCharacterEncoding(e uint8) {
+	enc.ch.CharacterEncoding = e
+}
+
+// SetHeaderVersion selects the version (1 or 2) of the Type Serialization headers written when headers are included.
+func (enc *Encoder) SetHeaderVersion(v uint8) {
+	enc.ch.Version = v
+}
+
+// SetInterfaceID sets the interface UUID and version written in a version 2 common header.
+func (enc *Encoder) SetInterfaceID(uuid string, major, minor uint16) error {
+	b, err := syntaxIdentifier(uuid, major, minor)
+	if err != nil {
+		return fmt.Errorf("invalid interface id: %v", err)
+	}
+	enc.ch.InterfaceID = b
+	return nil
+}
+
+// SetPipeChunkSize sets the max number of elements written in each chunk of a pipe.
+// A size of zero or less writes all the elements of the pipe in a single chunk.
+func (enc *Encoder) SetPipeChunkSize(n int) {
+	enc.pipeChunkSize = n
+}
+
+// SetMaxDepth sets the max nesting depth of deferred referents, such as the nodes of a linked list.
+// A depth of zero or less removes the limit.
+func (enc *Encoder) SetMaxDepth(n int) {
+	enc.maxDepth = n
+}
+
 func (enc *Encoder) process(s interface{}, tag reflect.StructTag) (err error) {
 	// Scan for conformant fields as their max counts are moved to the beginning
 	// http://pubs.opengroup.org/onlinepubs/9629399/chap14.htm#tagfcjh_37
@@ -85,8 +130,18 @@ func (enc *Encoder) process(s interface{}, tag reflect.StructTag) (err error) {
 		return Errorf("could not encode: %v", err)
 	}
 	// Write any deferred referents associated with pointers
-	for _, p := range localDef {
-		err = enc.process(p.v, p.tag)
+	return enc.processDeferred(localDef)
+}
+
+// processDeferred writes the deferred referents of the pointers in def in order.
+func (enc *Encoder) processDeferred(def []deferedPtr) error {
+	for _, p := range def {
+		enc.depth++
+		if enc.maxDepth > 0 && enc.depth > enc.maxDepth {
+			return fmt.Errorf("deferred referents nested deeper than the max depth of %d", enc.maxDepth)
+		}
+		err := enc.process(p.v, p.tag)
+		enc.depth--
 		if err != nil {
 			return fmt.Errorf("could not encode deferred referent: %v", err)
 		}
@@ -103,7 +158,7 @@ func (enc *Encoder) scanConformantArrays(s interface{}, tag reflect.StructTag) e
 	}
 	for i := range enc.conformantMax {
 		//fmt.Printf("Writing conformant max value of: %d for field: %v\n", enc.conformantMax[i], enc.current)
-		err = binary.Write(enc.w, binary.LittleEndian, enc.conformantMax[i])
+		err = enc.writeCount(enc.conformantMax[i])
 		if err != nil {
 			return fmt.Errorf("could not write preceding conformant max count index %d: %v", i, err)
 		}
@@ -127,60 +182,124 @@ func (enc *Encoder) conformantScan(s interface{}, tag reflect.StructTag) error {
 	//fmt.Printf("Checking conformant tag for type: %v\n", v.Kind())
 	switch v.Kind() {
 	case reflect.Struct:
+		// Fill in any fields with the counts of the arrays and strings of the struct before they are resolved
+		v, err := enc.withCorrelationFields(v)
+		if err != nil {
+			return err
+		}
 		for i := 0; i < v.NumField(); i++ {
-			err := enc.conformantScan(v.Field(i), v.Type().Field(i).Tag)
+			structTag, err := resolveFieldTags(v, v.Type().Field(i).Tag, v.NumField())
+			if err != nil {
+				return fmt.Errorf("could not process struct field(%s): %v", v.Type().Field(i).Name, err)
+			}
+			err = enc.conformantScan(v.Field(i), structTag)
 			if err != nil {
 				return err
 			}
 		}
 	case reflect.String:
-		if !ndrTag.HasValue(TagConformant) {
+		if !ndrTag.HasValue(TagConformant) || isFixedString(tag) {
 			break
 		}
 		//NOTE Conformant Max should be max num of elements (uint16) not max num of bytes
-		//NOTE does below changes to include null byte break anything?
 		// According to NDR rules, a string should always have a terminator at the end
 		// But RPCUnicodeStrings while handled as strings are not actually strings so need
 		// an extra Tag to avoid adding null byte at the end.
-		maxCount := uint32(v.Len())
-		if !ndrTag.HasValue(TagSkipNull) {
-			if !strings.HasSuffix(v.String(), "\x00") {
-				maxCount++
-			}
+		count, err := enc.countString(v.String(), tag)
+		if err != nil {
+			return err
 		}
-		enc.conformantMax = append(enc.conformantMax, maxCount)
-		//enc.conformantMax = append(enc.conformantMax, uint32(v.Len()))
+		if ndrTag.HasValue(TagSkipNull) && !strings.HasSuffix(v.String(), "\x00") {
+			count--
+		}
+		// The max count may be larger than the actual count if given by size_is
+		maxCount, err := sizeFromTag(tag, int(count))
+		if err != nil {
+			return err
+		}
+		if maxCount < int(count) {
+			return fmt.Errorf("%s %d is less than the actual count %d of the string", TagSizeIs, maxCount, count)
+		}
+		enc.conformantMax = append(enc.conformantMax, uint32(maxCount))
 	case reflect.Slice:
 		if !ndrTag.HasValue(TagConformant) {
 			break
 		}
+		if isUnitString(v, tag) {
+			count := len(unitString(v, ndrTag.HasValue(TagSkipNull)))
+			maxCount, err := sizeFromTag(tag, count)
+			if err != nil {
+				return err
+			}
+			if maxCount < count {
+				return fmt.Errorf("%s %d is less than the actual count %d of the string", TagSizeIs, maxCount, count)
+			}
+			enc.conformantMax = append(enc.conformantMax, uint32(maxCount))
+			break
+		}
 		d, t := sliceDimensions(v.Type())
+		l, err := sliceLengths(v, d)
+		if err != nil {
+			return fmt.Errorf("could not establish dimensions of conformant array: %v", err)
+		}
+		if hasSize(tag) {
+			if d > 1 {
+				return fmt.Errorf("%s is not supported for multi-dimensional conformant arrays", TagSizeIs)
+			}
+			m, err := sizeFromTag(tag, l[0])
+			if err != nil {
+				return err
+			}
+			if ndrTag.HasValue(TagVarying) || (t.Kind() == reflect.String && !isElementPointer(tag)) {
+				// Only the transmitted window must fit within the max count of a conformant varying array
+				o, s, err := varyingWindow(tag, l[0])
+				if err != nil {
+					return err
+				}
+				if m < o+s {
+					return fmt.Errorf("%s %d is less than the offset %d plus actual count %d", TagSizeIs, m, o, s)
+				}
+			} else if m != l[0] {
+				return fmt.Errorf("%s %d does not match the length %d of the conformant array", TagSizeIs, m, l[0])
+			}
+			l[0] = m
+		}
 		for i := 0; i < d; i++ {
-			//fmt.Printf("slice field: %s, dimension: %d has a conformantMax of: %d\n", fieldName, i, v.Len())
-			enc.conformantMax = append(enc.conformantMax, uint32(v.Len()))
+			enc.conformantMax = append(enc.conformantMax, uint32(l[i]))
 		}
 		// For string arrays there is a common max for the strings within the array.
-		if t.Kind() == reflect.String {
-			//TODO
-			//fmt.Printf("string array field: %s has a conformantMax of: uint32(0)\n", fieldName)
-			enc.conformantMax = append(enc.conformantMax, uint32(0))
+		if t.Kind() == reflect.String && !isElementPointer(tag) {
+			m, err := stringArrayMaxCount(v, enc.utf16Policy)
+			if err != nil {
+				return err
+			}
+			enc.conformantMax = append(enc.conformantMax, m)
 		}
 	}
 	return nil
 }
 
-func (enc *Encoder) isPointer(v reflect.Value, tag reflect.StructTag, def *[]deferedPtr) (bool, error) {
+func (enc *Encoder) isPointer(s interface{}, tag reflect.StructTag, def *[]deferedPtr) (bool, error) {
 	// Pointer so defer filling the referent
 	ndrTag := parseTags(tag)
 	var err error
 	if ndrTag.HasValue(TagPointer) {
 		ndrTag.delete(TagPointer)
-		if v.Kind() == reflect.Pointer && !v.IsNil() {
+		v := getReflectValue(s)
+		if r, ok := s.(reflect.Value); ok && r.Kind() == reflect.Pointer {
+			// A nil Go pointer is a NULL pointer while a non-nil Go pointer always has a referent, even if it is
+			// a zero value.
+			if r.IsNil() {
+				err = enc.writeReferentID(0)
+				if err != nil {
+					return true, fmt.Errorf("could not write empty pointer: %v", err)
+				}
+				return true, nil
+			}
 			err = enc.writePointer()
 			if err != nil {
 				return true, fmt.Errorf("could not write pointer: %v", err)
 			}
-			// if pointer is not zero add to the deferred items at end of stream
 			*def = append(*def, deferedPtr{v: v, tag: ndrTag.StructTag()})
 		} else if v.Kind() == reflect.Invalid {
 			// Nil ptr so no deferrence
@@ -206,7 +325,7 @@ func (enc *Encoder) isPointer(v reflect.Value, tag reflect.StructTag, def *[]def
 					// if pointer is not zero add to the deferred items at end of stream
 					*def = append(*def, deferedPtr{v: v, tag: ndrTag.StructTag()})
 				} else {
-					err = binary.Write(enc.w, binary.LittleEndian, uint32(0))
+					err = enc.writeReferentID(0)
 					if err != nil {
 						return true, fmt.Errorf("could not write empty pointer: %v", err)
 					}
@@ -232,7 +351,7 @@ func (enc *Encoder) isTopLevelPointer(v reflect.Value, tag reflect.StructTag, de
 				err = fmt.Errorf("A referent pointer cannot be NULL!")
 				return
 			}
-			err = binary.Write(enc.w, enc.ch.Endianness, uint32(0))
+			err = enc.writeReferentID(0)
 			if err != nil {
 				err = fmt.Errorf("could not write pointer: %v", err)
 				return
@@ -292,8 +411,17 @@ func (enc *Encoder) fill(s interface{}, tag reflect.StructTag, localDef *[]defer
 		return nil
 	}
 
+	// Full pointers may alias a referent that has already been written
+	ptr, err := enc.isFullPointer(s, tag, localDef)
+	if err != nil {
+		return fmt.Errorf("could not process struct field(%s): %v", strings.Join(enc.current, "/"), err)
+	}
+	if ptr {
+		return nil
+	}
+
 	// Pointer so defer filling the referent
-	ptr, err := enc.isPointer(v, tag, localDef)
+	ptr, err = enc.isPointer(s, tag, localDef)
 	if err != nil {
 		return fmt.Errorf("could not process struct field(%s): %v", strings.Join(enc.current, "/"), err)
 	}
@@ -316,16 +444,44 @@ func (enc *Encoder) fill(s interface{}, tag reflect.StructTag, localDef *[]defer
 		If a paramter has the unique keyword in IDL, that means that the pointer can be null and is considered a full pointer.
 	*/
 
+	// Integers with a size on the wire that differs between NDR and NDR64
+	ndrTag := parseTags(tag)
+	if ndrTag.HasValue(TagEnum) || ndrTag.HasValue(TagV1Enum) {
+		err = enc.writeEnum(v, tag)
+		if err != nil {
+			return fmt.Errorf("could not write enum struct field(%s): %v", strings.Join(enc.current, "/"), err)
+		}
+		return nil
+	}
+	if ndrTag.HasValue(TagInt3264) {
+		err = enc.writeInt3264(v)
+		if err != nil {
+			return fmt.Errorf("could not write int3264 struct field(%s): %v", strings.Join(enc.current, "/"), err)
+		}
+		return nil
+	}
+
 	// Populate the value from the byte stream
 	switch v.Kind() {
 	case reflect.Invalid:
 		// NIL ptr
-		err = binary.Write(enc.w, enc.ch.Endianness, uint32(0))
+		err = enc.writeReferentID(0)
 		if err != nil {
 			return fmt.Errorf("could not fill struct field(%s): %v", strings.Join(enc.current, "/"), err)
 		}
 	case reflect.Struct:
+		// In NDR64 a structure is aligned to the largest alignment of its members and padded at the end to a multiple of it
+		var align int
+		if enc.ndr64 {
+			align = ndr64Alignment(v.Type(), reflect.StructTag(""))
+			enc.ensureAlignment(align)
+		}
 		enc.current = append(enc.current, v.Type().Name()) //Track the current field being filled
+		// Fill in any fields with the counts of the arrays and strings of the struct before they are written
+		v, err = enc.withCorrelationFields(v)
+		if err != nil {
+			return fmt.Errorf("could not fill struct field(%s): %v", strings.Join(enc.current, "/"), err)
+		}
 		// in case struct is a union, track this and the selected union field for efficiency
 		var unionTag reflect.Value
 		var unionField string // field to fill if struct is a union
@@ -342,7 +498,10 @@ func (enc *Encoder) fill(s interface{}, tag reflect.StructTag, localDef *[]defer
 			// Union handling
 			if !unionTag.IsValid() {
 				// Is this field a union tag?
-				//unionTag = enc.isUnion(v.Field(i), structTag)
+				unionTag, err = enc.isUnion(v.Field(i), structTag)
+				if err != nil {
+					return fmt.Errorf("could not write union discriminant for %s: %v", strings.Join(enc.current, "/"), err)
+				}
 			} else {
 				// What is the selected field value of the union if we don't already know
 				if unionField == "" {
@@ -357,14 +516,48 @@ func (enc *Encoder) fill(s interface{}, tag reflect.StructTag, localDef *[]defer
 					enc.current = enc.current[:len(enc.current)-1] //This field has been skipped so remove it from the current field tracker
 					continue
 				}
+				if enc.ndr64 && fieldName == unionField {
+					// In NDR64 the selected arm is aligned to the largest alignment of all the arms
+					// while in NDR each arm is aligned by its own type like any other member, see Unions in
+					// http://pubs.opengroup.org/onlinepubs/9629399/chap14.htm
+					enc.ensureAlignment(unionArmAlignment(v.Type()))
+				}
 			}
 
-			err := enc.fill(v.Field(i), structTag, localDef)
+			// Resolve any sibling fields with the counts of an array before the array may be deferred
+			structTag, err = resolveFieldTags(v, structTag, v.NumField())
 			if err != nil {
-				return fmt.Errorf("could not fill struct field(%s): %v", strings.Join(enc.current, "/"), err)
+				return fmt.Errorf("could not process struct field(%s): %v", strings.Join(enc.current, "/"), err)
+			}
+
+			if v.Field(i).Type().Implements(reflect.TypeOf(new(RawBytes)).Elem()) &&
+				v.Field(i).Type().Kind() == reflect.Slice && v.Field(i).Type().Elem().Kind() == reflect.Uint8 {
+				//field is for rawbytes
+				structTag, err = addSizeToTag(v, v.Field(i), structTag)
+				if err != nil {
+					return fmt.Errorf("could not get rawbytes field(%s) size: %v", strings.Join(enc.current, "/"), err)
+				}
+				ptr, err := enc.isPointer(v.Field(i), structTag, localDef)
+				if err != nil {
+					return fmt.Errorf("could not process struct field(%s): %v", strings.Join(enc.current, "/"), err)
+				}
+				if !ptr {
+					err := enc.writeRawBytes(v.Field(i), structTag)
+					if err != nil {
+						return fmt.Errorf("could not write raw bytes struct field(%s): %v", strings.Join(enc.current, "/"), err)
+					}
+				}
+			} else {
+				err := enc.fill(v.Field(i), structTag, localDef)
+				if err != nil {
+					return fmt.Errorf("could not fill struct field(%s): %v", strings.Join(enc.current, "/"), err)
+				}
 			}
 			enc.current = enc.current[:len(enc.current)-1] //This field has been filled so remove it from the current field tracker
 		}
+		if enc.ndr64 {
+			enc.ensureAlignment(align)
+		}
 		enc.current = enc.current[:len(enc.current)-1] //This field has been filled so remove it from the current field tracker
 	case reflect.Bool:
 		err := enc.writeBool(v.Bool())
@@ -415,6 +608,13 @@ func (enc *Encoder) fill(s interface{}, tag reflect.StructTag, localDef *[]defer
 		ndrTag := parseTags(tag)
 		conformant := ndrTag.HasValue(TagConformant)
 		skipNull := ndrTag.HasValue(TagSkipNull)
+		if isFixedString(tag) {
+			err := enc.writeFixedString(v.String(), tag, localDef)
+			if err != nil {
+				return fmt.Errorf("could not write fixed string: %v", err)
+			}
+			break
+		}
 		// strings are always varying so this is assumed without an explicit tag
 		var err error
 		s := v.String()
@@ -423,19 +623,42 @@ func (enc *Encoder) fill(s interface{}, tag reflect.StructTag, localDef *[]defer
 		if !strings.HasSuffix(s, "\x00") && !skipNull {
 			s += "\x00"
 		}
+		var b []byte
+		var count int
+		if isCharString(tag) {
+			b, err = encodeChars(s, enc.ch.CharacterEncoding, enc.codePage)
+			if err != nil {
+				return fmt.Errorf("could not write character string: %v", err)
+			}
+			count = len(b)
+		} else {
+			count, err = utf16Len(s, enc.utf16Policy)
+			if err != nil {
+				return fmt.Errorf("could not write string: %v", err)
+			}
+		}
+		if l, ok, err := resolvedTagValue(tag, TagLengthIs); err != nil {
+			return err
+		} else if ok && l != count {
+			return fmt.Errorf("%s %d does not match the actual count %d of the string", TagLengthIs, l, count)
+		}
 
-		if conformant {
+		if b != nil {
+			err = enc.writeCharString(b)
+			if err != nil {
+				return fmt.Errorf("could not write character string: %v", err)
+			}
+		} else if conformant {
 			//err = enc.writeConformantVaryingString(v.String())
 			err = enc.writeConformantVaryingString(s)
 			if err != nil {
 				return fmt.Errorf("could not write with conformant varying string: %v", err)
 			}
 		} else {
-			//s, err = enc.readVaryingString(localDef)
-			//if err != nil {
-			//	return fmt.Errorf("could not fill with varying string: %v", err)
-			//}
-			return fmt.Errorf("Haven't implemented varying strings yet")
+			err = enc.writeVaryingString(s)
+			if err != nil {
+				return fmt.Errorf("could not write with varying string: %v", err)
+			}
 		}
 	case reflect.Float32:
 		err := enc.writeFloat32(float32(v.Float()))
@@ -453,33 +676,46 @@ func (enc *Encoder) fill(s interface{}, tag reflect.StructTag, localDef *[]defer
 			return err
 		}
 	case reflect.Slice:
-		//if v.Type().Implements(reflect.TypeOf(new(RawBytes)).Elem()) && v.Type().Elem().Kind() == reflect.Uint8 {
-		//	//field is for rawbytes
-		//	err := enc.readRawBytes(v, tag)
-		//	if err != nil {
-		//		return fmt.Errorf("could not fill raw bytes struct field(%s): %v", strings.Join(enc.current, "/"), err)
-		//	}
-		//	break
-		//}
+		if v.Type().Implements(reflect.TypeOf(new(RawBytes)).Elem()) && v.Type().Elem().Kind() == reflect.Uint8 {
+			//field is for rawbytes
+			err := enc.writeRawBytes(v, tag)
+			if err != nil {
+				return fmt.Errorf("could not write raw bytes struct field(%s): %v", strings.Join(enc.current, "/"), err)
+			}
+			break
+		}
 		ndrTag := parseTags(tag)
 		conformant := ndrTag.HasValue(TagConformant)
 		varying := ndrTag.HasValue(TagVarying)
-		//if ndrTag.HasValue(TagPipe) {
-		//	err := enc.fillPipe(v, tag)
-		//	if err != nil {
-		//		return err
-		//	}
-		//	break
-		//}
-		//_, t := sliceDimensions(v.Type())
-		//if t.Kind() == reflect.String && !ndrTag.HasValue(subStringArrayValue) {
-		//	// String array
-		//	err := enc.readStringsArray(v, tag, localDef)
-		//	if err != nil {
-		//		return err
-		//	}
-		//	break
-		//}
+		if ndrTag.HasValue(TagPipe) {
+			err := enc.writePipe(v, tag)
+			if err != nil {
+				return err
+			}
+			break
+		}
+		if isUnitString(v, tag) {
+			a := unitString(v, ndrTag.HasValue(TagSkipNull))
+			if l, ok, err := resolvedTagValue(tag, TagLengthIs); err != nil {
+				return err
+			} else if ok && l != len(a) {
+				return fmt.Errorf("%s %d does not match the actual count %d of the string", TagLengthIs, l, len(a))
+			}
+			err := enc.writeVaryingUnits(a)
+			if err != nil {
+				return fmt.Errorf("could not write UTF-16 string: %v", err)
+			}
+			break
+		}
+		_, t := sliceDimensions(v.Type())
+		if t.Kind() == reflect.String && !ndrTag.HasValue(subStringArrayValue) && !isElementPointer(tag) {
+			// String array
+			err := enc.writeStringsArray(v, tag, localDef)
+			if err != nil {
+				return err
+			}
+			break
+		}
 		// varying is assumed as fixed arrays use the Go array type rather than slice
 		if conformant && varying {
 			err := enc.writeConformantVaryingArray(v, tag, localDef)
@@ -559,19 +795,29 @@ func (enc *Encoder) writeInt64(val int64) error {
 }
 
 func (enc *Encoder) writeFloat32(val float32) (err error) {
+	if enc.ch.FloatRepresentation != ieee {
+		return enc.writeFloat(float64(val), SizeSingle)
+	}
 	enc.ensureAlignment(SizeSingle)
 	return binary.Write(enc.w, enc.ch.Endianness, val)
 }
 
 func (enc *Encoder) writeFloat64(val float64) (err error) {
+	if enc.ch.FloatRepresentation != ieee {
+		return enc.writeFloat(val, SizeDouble)
+	}
 	enc.ensureAlignment(SizeDouble)
 	return binary.Write(enc.w, enc.ch.Endianness, val)
 }
 
-func (enc *Encoder) writePointer() error {
-	enc.ensureAlignment(SizePtr)
+func (enc *Encoder) newReferentID() uint32 {
 	refId := enc.nextReferentID
 	enc.nextReferentID += 4
+	return refId
+}
+
+func (enc *Encoder) writePointer() error {
+	refId := enc.newReferentID()
 	//fmt.Printf("Writing pointer with refId: 0x%08x\n", refId)
-	return binary.Write(enc.w, enc.ch.Endianness, refId)
+	return enc.writeReferentID(refId)
 }
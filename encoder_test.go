@@ -0,0 +1,135 @@
+package ndr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testInterfaceID = "12345778-1234-abcd-ef00-0123456789ab" // MS-LSAD
+
+func TestWriteHeaderV1(t *testing.T) {
+	a := SimpleTest{A: 258377425, B: 29780581}
+	enc := NewEncoder(new(bytes.Buffer), true)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// common header:private header with length 16:referent:A:B:padding
+	assert.Equal(t, "01100800cccccccc"+"1000000000000000"+"00000200"+"d186660f656ac601"+"00000000", hex.EncodeToString(b), "encoded bytes not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), true)
+	d := new(SimpleTest)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "value not as expected after round trip")
+	assert.Equal(t, uint8(1), dec.CommonHeader().Version, "header version not as expected")
+	assert.Equal(t, uint32(16), dec.PrivateHeader().ObjectBufferLength, "object buffer length not as expected")
+}
+
+func TestWriteHeaderV2(t *testing.T) {
+	a := SimpleTest{A: 258377425, B: 29780581}
+	enc := NewEncoder(new(bytes.Buffer), true)
+	enc.SetHeaderVersion(2)
+	err := enc.SetInterfaceID(testInterfaceID, 0, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, 80+16, len(b), "length of encoded bytes not as expected")
+	assert.Equal(t, "02104000cccccccc", hex.EncodeToString(b[:8]), "common header not as expected")
+	assert.Equal(t, "045d888aeb1cc9119fe808002b10486002000000", hex.EncodeToString(b[24:44]), "transfer syntax not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), true)
+	d := new(SimpleTest)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "value not as expected after round trip")
+	ifID, _ := syntaxIdentifier(testInterfaceID, 0, 0)
+	assert.Equal(t, uint8(2), dec.CommonHeader().Version, "header version not as expected")
+	assert.Equal(t, ifID, dec.CommonHeader().InterfaceID, "interface id not as expected")
+	assert.Equal(t, uint32(16), dec.PrivateHeader().ObjectBufferLength, "object buffer length not as expected")
+}
+
+func TestWriteHeaderInvalid(t *testing.T) {
+	enc := NewEncoder(new(bytes.Buffer), true)
+	enc.SetHeaderVersion(3)
+	_, err := enc.Encode(&SimpleTest{})
+	if err == nil {
+		t.Errorf("expected error when writing header of invalid version")
+	}
+	enc = NewEncoder(new(bytes.Buffer), true)
+	enc.SetCharacterEncoding(2)
+	_, err = enc.Encode(&SimpleTest{})
+	if err == nil {
+		t.Errorf("expected error when writing header with invalid character encoding")
+	}
+}
+
+type testEndianness struct {
+	A uint16
+	B uint32
+	C uint64
+	D float64
+	E []uint16 `ndr:"conformant"`
+	F string   `ndr:"conformant"`
+	G *uint32  `ndr:"pointer"`
+	H uint32   `ndr:"pointer"`
+}
+
+func TestWriteBigEndian(t *testing.T) {
+	g := uint32(7)
+	a := testEndianness{A: 1, B: 2, C: 3, D: 1.5, E: []uint16{4, 5}, F: "ab", G: &g}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	enc.SetEndianness(binary.BigEndian)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := "00000002" + "00000003" + // conformant max counts of E and F
+		"0001" + "0000" + "00000002" + "0000000000000003" + "3ff8000000000000" + // A:alignment:B:C:D
+		"00040005" + "00000000" + "00000003" + "006100620000" + "0000" + // E:F offset, actual count and data:alignment
+		"00020000" + "00000000" + // G:H (NULL)
+		"00000007" // referent of G
+	assert.Equal(t, expected, hex.EncodeToString(b), "big-endian encoding not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), false)
+	dec.SetEndianness(binary.BigEndian)
+	d := new(testEndianness)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "value not as expected after round trip")
+}
+
+func TestWriteBigEndianHeader(t *testing.T) {
+	a := SimpleTest{A: 1, B: 2}
+	enc := NewEncoder(new(bytes.Buffer), true)
+	enc.SetEndianness(binary.BigEndian)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// common header:private header with length 16:referent:A:B:padding
+	assert.Equal(t, "01000008cccccccc"+"0000001000000000"+"00020000"+"0000000100000002"+"00000000", hex.EncodeToString(b), "encoded bytes not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), true)
+	d := new(SimpleTest)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "value not as expected after round trip")
+	assert.Equal(t, binary.BigEndian, dec.CommonHeader().Endianness, "endianness not as expected")
+}
@@ -0,0 +1,121 @@
+package ndr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+)
+
+/*
+Enumerated types
+
+A field of any Go integer kind tagged with "enum" is marshalled as an IDL enum, a signed short of 2 bytes in NDR and
+4 bytes in NDR64. A field tagged with "v1_enum" is marshalled as an IDL [v1_enum], a signed long of 4 bytes.
+If the allowed values of the Go type have been registered with RegisterEnum, other values are rejected both when
+encoding and decoding.
+*/
+
+var (
+	enumsMux sync.RWMutex
+	enums    = make(map[reflect.Type]map[int64]bool) // allowed values of registered enumerated types
+)
+
+// RegisterEnum registers the allowed values of an enumerated type. The values must all be of the same Go integer type.
+// Registering more values of an already registered type adds to the allowed values.
+func RegisterEnum(values ...interface{}) error {
+	if len(values) == 0 {
+		return errors.New("no enum values to register")
+	}
+	t := reflect.TypeOf(values[0])
+	allowed := make(map[int64]bool)
+	for _, val := range values {
+		v := reflect.ValueOf(val)
+		if v.Type() != t {
+			return fmt.Errorf("enum value %v of type %v is not of type %v", val, v.Type(), t)
+		}
+		n, err := integerValue(v)
+		if err != nil {
+			return fmt.Errorf("invalid enum value %v: %v", val, err)
+		}
+		allowed[n] = true
+	}
+	enumsMux.Lock()
+	defer enumsMux.Unlock()
+	if enums[t] == nil {
+		enums[t] = allowed
+		return nil
+	}
+	for n := range allowed {
+		enums[t][n] = true
+	}
+	return nil
+}
+
+// checkEnum returns an error if the type t is a registered enumerated type and n is not one of its allowed values.
+func checkEnum(t reflect.Type, n int64) error {
+	enumsMux.RLock()
+	defer enumsMux.RUnlock()
+	if allowed, ok := enums[t]; ok && !allowed[n] {
+		return fmt.Errorf("value %d is not a valid %v", n, t)
+	}
+	return nil
+}
+
+// enumSize returns the size on the wire of an enum with the tag.
+func enumSize(tag reflect.StructTag, ndr64 bool) int {
+	ndrTag := parseTags(tag)
+	if ndrTag.HasValue(TagV1Enum) {
+		return SizeV1Enum
+	}
+	if ndr64 {
+		return SizeNDR64Enum
+	}
+	return SizeEnum
+}
+
+// fillEnum reads an enum into any Go integer kind.
+func (dec *Decoder) fillEnum(v reflect.Value, tag reflect.StructTag) error {
+	var n int64
+	if enumSize(tag, dec.ndr64) != SizeEnum {
+		i, err := dec.readInt32()
+		if err != nil {
+			return err
+		}
+		n = int64(i)
+	} else {
+		i, err := dec.readInt16()
+		if err != nil {
+			return err
+		}
+		n = int64(i)
+	}
+	err := checkEnum(v.Type(), n)
+	if err != nil {
+		return err
+	}
+	return setInteger(v, uint64(n), true)
+}
+
+// writeEnum writes any Go integer kind as an enum.
+func (enc *Encoder) writeEnum(v reflect.Value, tag reflect.StructTag) error {
+	n, err := integerValue(v)
+	if err != nil {
+		return err
+	}
+	err = checkEnum(v.Type(), n)
+	if err != nil {
+		return err
+	}
+	if enumSize(tag, enc.ndr64) != SizeEnum {
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			return fmt.Errorf("value %d does not fit in a 32-bit enum", n)
+		}
+		return enc.writeInt32(int32(n))
+	}
+	if n < math.MinInt16 || n > math.MaxInt16 {
+		return fmt.Errorf("value %d does not fit in a 16-bit enum", n)
+	}
+	return enc.writeInt16(int16(n))
+}
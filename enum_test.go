@@ -0,0 +1,92 @@
+package ndr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testEnumType int
+
+const (
+	testEnumFirst testEnumType = iota + 1
+	testEnumSecond
+)
+
+func (e testEnumType) String() string {
+	switch e {
+	case testEnumFirst:
+		return "first"
+	case testEnumSecond:
+		return "second"
+	}
+	return "unknown"
+}
+
+type testRegisteredEnumType uint8
+
+type testEnums struct {
+	A testEnumType `ndr:"enum"`
+	B testEnumType `ndr:"v1_enum"`
+	C int8         `ndr:"enum"`
+}
+
+type testRegisteredEnums struct {
+	A testRegisteredEnumType `ndr:"enum"`
+}
+
+func init() {
+	RegisterEnum(testRegisteredEnumType(1), testRegisteredEnumType(2))
+}
+
+func TestEnums(t *testing.T) {
+	a := testEnums{A: testEnumFirst, B: testEnumSecond, C: -1}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// A as a short:padding:B as a long:C as a short
+	assert.Equal(t, "0100"+"0000"+"02000000"+"ffff", hex.EncodeToString(b), "encoded bytes not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), false)
+	d := new(testEnums)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "value not as expected after round trip")
+	assert.Equal(t, "second", d.B.String(), "value not as expected after round trip")
+}
+
+func TestEnumOverflow(t *testing.T) {
+	a := testEnums{A: 0x8000}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	_, err := enc.Encode(&a)
+	assert.Error(t, err, "expected error for enum value not fitting in a short")
+}
+
+func TestRegisteredEnum(t *testing.T) {
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&testRegisteredEnums{A: 2})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, "0200", hex.EncodeToString(b), "encoded bytes not as expected")
+
+	enc = NewEncoder(new(bytes.Buffer), false)
+	_, err = enc.Encode(&testRegisteredEnums{A: 3})
+	assert.Error(t, err, "expected error encoding a value that is not registered")
+
+	b, _ = hex.DecodeString("0300")
+	dec := NewDecoder(bytes.NewReader(b), false)
+	err = dec.Decode(new(testRegisteredEnums))
+	assert.Error(t, err, "expected error decoding a value that is not registered")
+}
+
+func TestRegisterEnumMixedTypes(t *testing.T) {
+	err := RegisterEnum(testEnumFirst, 2)
+	assert.Error(t, err, "expected error registering values of different types")
+}
@@ -0,0 +1,302 @@
+package ndr
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+/*
+Floating-point representations
+
+C706 allows floating-point numbers in the IEEE, VAX, Cray and IBM representations, as indicated by the floating-point
+representation of the NDR format label:
+- VAX floats use the F_floating format for float and the G_floating format for double. They are in the VAX memory
+  layout of 16-bit words, the word with the sign and exponent first, with each word in the integer endianness.
+- IBM floats use the hexadecimal single and double precision formats in the integer endianness.
+- Cray floats use the 64-bit Cray format in the integer endianness for both float and double, so a float occupies 8
+  octets.
+
+Values are converted to and from the Go float32 and float64 types. A value that cannot be represented in the target
+format is an error, while a value too small to be represented becomes zero.
+*/
+
+// Floating-point representations that can be selected in the NDR format label
+const (
+	FloatRepresentationIEEE = ieee
+	FloatRepresentationVAX  = vax
+	FloatRepresentationCray = cray
+	FloatRepresentationIBM  = ibm
+)
+
+const sizeCrayFloat = 8 // Cray floats are 8 octets for both float and double
+
+// SetFloatRepresentation selects the floating-point representation of the byte stream.
+func (dec *Decoder) SetFloatRepresentation(f uint8) {
+	dec.ch.FloatRepresentation = f
+}
+
+// SetFormatLabel sets the integer endianness, character encoding and floating-point representation from the 4 octet
+// NDR format label, also known as the data representation, of a DCE RPC PDU: http://pubs.opengroup.org/onlinepubs/9629399/chap14.htm#tagcjh_19_02
+func (dec *Decoder) SetFormatLabel(label []byte) error {
+	if len(label) != 4 {
+		return fmt.Errorf("NDR format label must be 4 octets, not %d", len(label))
+	}
+	switch label[0] >> 4 {
+	case bigEndian:
+		dec.SetEndianness(binary.BigEndian)
+	case littleEndian:
+		dec.SetEndianness(binary.LittleEndian)
+	default:
+		return fmt.Errorf("NDR format label does not indicate a valid endianness: %#02x", label[0])
+	}
+	charEncoding := label[0] & 0xF
+	if charEncoding != ascii && charEncoding != ebcdic {
+		return fmt.Errorf("NDR format label does not indicate a valid character encoding: %#02x", label[0])
+	}
+	if label[1] > ibm {
+		return fmt.Errorf("NDR format label does not indicate a valid floating-point representation: %#02x", label[1])
+	}
+	dec.SetCharacterEncoding(charEncoding)
+	dec.SetFloatRepresentation(label[1])
+	return nil
+}
+
+// SetFloatRepresentation selects the floating-point representation of the byte stream.
+func (enc *Encoder) SetFloatRepresentation(f uint8) {
+	enc.ch.FloatRepresentation = f
+}
+
+// vaxWords reorders the bits of a VAX float read as an integer of the stream endianness, so that the first 16-bit
+// word, holding the sign and exponent, is the most significant, and the reverse.
+func vaxWords(bits uint64, words int) uint64 {
+	var r uint64
+	for i := 0; i < words; i++ {
+		r = r<<16 | bits&0xFFFF
+		bits >>= 16
+	}
+	return r
+}
+
+// fromVAXF converts a VAX F_floating value to a float64.
+func fromVAXF(bits uint32) (float64, error) {
+	s := bits >> 31
+	e := int(bits >> 23 & 0xFF)
+	f := bits & 0x7FFFFF
+	if e == 0 {
+		if s == 1 {
+			return 0, errors.New("VAX reserved operand")
+		}
+		return 0, nil
+	}
+	// 0.1f * 2^(e-128)
+	x := math.Ldexp(float64(f|1<<23), e-128-24)
+	if s == 1 {
+		x = -x
+	}
+	return x, nil
+}
+
+// toVAXF converts a float64 to a VAX F_floating value.
+func toVAXF(x float64) (uint32, error) {
+	s, frac, exp, err := splitFloat(x, 24)
+	if err != nil || frac == 0 {
+		return 0, err
+	}
+	e := exp + 128
+	if e > 0xFF {
+		return 0, fmt.Errorf("%g is out of range of a VAX F_floating", x)
+	}
+	if e < 1 {
+		return 0, nil
+	}
+	return uint32(s)<<31 | uint32(e)<<23 | uint32(frac)&0x7FFFFF, nil
+}
+
+// fromVAXG converts a VAX G_floating value to a float64.
+func fromVAXG(bits uint64) (float64, error) {
+	s := bits >> 63
+	e := int(bits >> 52 & 0x7FF)
+	f := bits & (1<<52 - 1)
+	if e == 0 {
+		if s == 1 {
+			return 0, errors.New("VAX reserved operand")
+		}
+		return 0, nil
+	}
+	// 0.1f * 2^(e-1024)
+	x := math.Ldexp(float64(f|1<<52), e-1024-53)
+	if s == 1 {
+		x = -x
+	}
+	return x, nil
+}
+
+// toVAXG converts a float64 to a VAX G_floating value.
+func toVAXG(x float64) (uint64, error) {
+	s, frac, exp, err := splitFloat(x, 53)
+	if err != nil || frac == 0 {
+		return 0, err
+	}
+	e := exp + 1024
+	if e > 0x7FF {
+		return 0, fmt.Errorf("%g is out of range of a VAX G_floating", x)
+	}
+	if e < 1 {
+		return 0, nil
+	}
+	return s<<63 | uint64(e)<<52 | frac&(1<<52-1), nil
+}
+
+// fromIBM converts an IBM hexadecimal floating-point value with a fraction of n bits to a float64.
+func fromIBM(bits uint64, n int) float64 {
+	s := bits >> (n + 7)
+	e := int(bits >> n & 0x7F)
+	f := bits & (1<<n - 1)
+	// 0.f * 16^(e-64)
+	x := math.Ldexp(float64(f), 4*(e-64)-n)
+	if s == 1 {
+		x = -x
+	}
+	return x
+}
+
+// toIBM converts a float64 to an IBM hexadecimal floating-point value with a fraction of n bits.
+func toIBM(x float64, n int) (uint64, error) {
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return 0, fmt.Errorf("%g cannot be represented as an IBM float", x)
+	}
+	var s uint64
+	if math.Signbit(x) {
+		s = 1
+		x = -x
+	}
+	if x == 0 {
+		return s << (n + 7), nil
+	}
+	frac, exp := math.Frexp(x)
+	// Shift the binary exponent up to a multiple of 4 as the exponent is base 16
+	shift := (4 - exp%4) % 4
+	e := (exp+shift)/4 + 64
+	f := uint64(math.Round(math.Ldexp(frac, n-shift)))
+	if f == 1<<n {
+		f >>= 4
+		e++
+	}
+	if e > 0x7F {
+		return 0, fmt.Errorf("%g is out of range of an IBM float", x)
+	}
+	if e < 0 {
+		return s << (n + 7), nil
+	}
+	return s<<(n+7) | uint64(e)<<n | f, nil
+}
+
+// fromCray converts a Cray floating-point value to a float64.
+func fromCray(bits uint64) float64 {
+	s := bits >> 63
+	e := int(bits >> 48 & 0x7FFF)
+	f := bits & (1<<48 - 1)
+	// 0.f * 2^(e-16384)
+	x := math.Ldexp(float64(f), e-16384-48)
+	if s == 1 {
+		x = -x
+	}
+	return x
+}
+
+// toCray converts a float64 to a Cray floating-point value.
+func toCray(x float64) (uint64, error) {
+	s, frac, exp, err := splitFloat(x, 48)
+	if err != nil || frac == 0 {
+		return 0, err
+	}
+	return s<<63 | uint64(exp+16384)<<48 | frac, nil
+}
+
+// splitFloat splits x into a sign bit, and a normalized fraction of n bits and a binary exponent such that
+// x = 0.frac * 2^exp.
+func splitFloat(x float64, n int) (s, frac uint64, exp int, err error) {
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return 0, 0, 0, fmt.Errorf("%g cannot be represented in a non IEEE floating-point representation", x)
+	}
+	if math.Signbit(x) {
+		s = 1
+		x = -x
+	}
+	if x == 0 {
+		return
+	}
+	f, exp := math.Frexp(x)
+	frac = uint64(math.Round(math.Ldexp(f, n)))
+	if frac == 1<<n {
+		frac >>= 1
+		exp++
+	}
+	return s, frac, exp, nil
+}
+
+// readFloat reads a floating-point number of the given size in octets in a non IEEE representation.
+func (dec *Decoder) readFloat(size int) (float64, error) {
+	f := dec.ch.FloatRepresentation
+	if f == cray {
+		size = sizeCrayFloat
+	}
+	dec.ensureAlignment(size)
+	b, err := dec.readBytes(size)
+	if err != nil {
+		return 0, err
+	}
+	var bits uint64
+	if size == SizeSingle {
+		bits = uint64(dec.ch.Endianness.Uint32(b))
+	} else {
+		bits = dec.ch.Endianness.Uint64(b)
+	}
+	switch {
+	case f == vax && size == SizeSingle:
+		return fromVAXF(uint32(vaxWords(bits, 2)))
+	case f == vax:
+		return fromVAXG(vaxWords(bits, 4))
+	case f == ibm && size == SizeSingle:
+		return fromIBM(bits, 24), nil
+	case f == ibm:
+		return fromIBM(bits, 56), nil
+	case f == cray:
+		return fromCray(bits), nil
+	}
+	return 0, fmt.Errorf("unsupported floating-point representation %d", f)
+}
+
+// writeFloat writes a floating-point number of the given size in octets in a non IEEE representation.
+func (enc *Encoder) writeFloat(x float64, size int) error {
+	f := enc.ch.FloatRepresentation
+	var bits uint64
+	var err error
+	switch {
+	case f == vax && size == SizeSingle:
+		var b uint32
+		b, err = toVAXF(x)
+		bits = vaxWords(uint64(b), 2)
+	case f == vax:
+		bits, err = toVAXG(x)
+		bits = vaxWords(bits, 4)
+	case f == ibm && size == SizeSingle:
+		bits, err = toIBM(x, 24)
+	case f == ibm:
+		bits, err = toIBM(x, 56)
+	case f == cray:
+		bits, err = toCray(x)
+		size = sizeCrayFloat
+	default:
+		return fmt.Errorf("unsupported floating-point representation %d", f)
+	}
+	if err != nil {
+		return err
+	}
+	if size == SizeSingle {
+		return enc.writeUint32(uint32(bits))
+	}
+	return enc.writeUint64(bits)
+}
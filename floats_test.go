@@ -0,0 +1,103 @@
+package ndr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testFloats struct {
+	A float32
+	B float64
+}
+
+func TestFloatRepresentations(t *testing.T) {
+	var tests = []struct {
+		Float  uint8
+		Endian binary.ByteOrder
+		In     testFloats
+		Hex    string
+	}{
+		{FloatRepresentationIEEE, binary.LittleEndian, testFloats{1, 1}, "0000803f" + "00000000" + "000000000000f03f"},
+		// VAX memory layout with the sign and exponent word first
+		{FloatRepresentationVAX, binary.LittleEndian, testFloats{1, 1}, "80400000" + "00000000" + "1040000000000000"},
+		{FloatRepresentationVAX, binary.LittleEndian, testFloats{-0.15625, 3.5}, "20bf0000" + "00000000" + "2c40000000000000"},
+		{FloatRepresentationIBM, binary.BigEndian, testFloats{1, 1}, "41100000" + "00000000" + "4110000000000000"},
+		{FloatRepresentationIBM, binary.BigEndian, testFloats{-118.625, 0.5}, "c276a000" + "00000000" + "4080000000000000"},
+		// Cray floats are 8 octets for both float and double
+		{FloatRepresentationCray, binary.BigEndian, testFloats{1, -0.5}, "4001800000000000" + "c000800000000000"},
+	}
+	for i, test := range tests {
+		enc := NewEncoder(new(bytes.Buffer), false)
+		enc.SetEndianness(test.Endian)
+		enc.SetFloatRepresentation(test.Float)
+		b, err := enc.Encode(&test.In)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		assert.Equal(t, test.Hex, hex.EncodeToString(b), "encoded bytes not as expected for test %d", i)
+
+		dec := NewDecoder(bytes.NewReader(b), false)
+		dec.SetEndianness(test.Endian)
+		dec.SetFloatRepresentation(test.Float)
+		a := new(testFloats)
+		err = dec.Decode(a)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		assert.Equal(t, test.In, *a, "value not as expected after round trip for test %d", i)
+	}
+}
+
+func TestFloatRepresentationErrors(t *testing.T) {
+	enc := NewEncoder(new(bytes.Buffer), false)
+	enc.SetFloatRepresentation(FloatRepresentationVAX)
+	_, err := enc.Encode(&testFloats{B: math.Inf(1)})
+	if err == nil {
+		t.Errorf("expected error encoding infinity as a VAX float")
+	}
+	_, err = enc.Encode(&testFloats{B: math.MaxFloat64})
+	if err == nil {
+		t.Errorf("expected error encoding a value out of range of a VAX float")
+	}
+
+	// VAX reserved operand
+	b, _ := hex.DecodeString("00800000" + "00000000" + "0000000000000000")
+	dec := NewDecoder(bytes.NewReader(b), false)
+	dec.SetFloatRepresentation(FloatRepresentationVAX)
+	err = dec.Decode(new(testFloats))
+	if err == nil {
+		t.Errorf("expected error decoding a VAX reserved operand")
+	}
+
+	// IBM float too large for a float32
+	b, _ = hex.DecodeString("7f100000" + "00000000" + "0000000000000000")
+	dec = NewDecoder(bytes.NewReader(b), false)
+	dec.SetEndianness(binary.BigEndian)
+	dec.SetFloatRepresentation(FloatRepresentationIBM)
+	err = dec.Decode(new(testFloats))
+	if err == nil {
+		t.Errorf("expected error decoding an IBM float out of range of a float32")
+	}
+}
+
+func TestSetFormatLabel(t *testing.T) {
+	dec := NewDecoder(bytes.NewReader([]byte{}), false)
+	err := dec.SetFormatLabel([]byte{0x01, 0x03, 0x00, 0x00})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	ch := dec.CommonHeader()
+	assert.Equal(t, binary.BigEndian, ch.Endianness, "endianness not as expected")
+	assert.Equal(t, CharacterEncodingEBCDIC, ch.CharacterEncoding, "character encoding not as expected")
+	assert.Equal(t, FloatRepresentationIBM, ch.FloatRepresentation, "floating-point representation not as expected")
+
+	err = dec.SetFormatLabel([]byte{0x10, 0x04, 0x00, 0x00})
+	if err == nil {
+		t.Errorf("expected error for an invalid floating-point representation")
+	}
+}
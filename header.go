@@ -25,16 +25,24 @@ Private Header - https://msdn.microsoft.com/en-us/library/cc243919.aspx
 */
 
 const (
-	protocolVersion   uint8  = 1
-	commonHeaderBytes uint16 = 8
-	bigEndian                = 0
-	littleEndian             = 1
-	ascii             uint8  = 0
-	ebcdic            uint8  = 1
-	ieee              uint8  = 0
-	vax               uint8  = 1
-	cray              uint8  = 2
-	ibm               uint8  = 3
+	protocolVersion       uint8  = 1
+	commonHeaderBytes     uint16 = 8
+	commonHeaderV2Bytes   uint16 = 0x40
+	ndrTransferSyntaxUUID        = "8a885d04-1ceb-11c9-9fe8-08002b104860" // NDR Transfer Syntax version 2.0
+	bigEndian                    = 0
+	littleEndian                 = 1
+	ascii                 uint8  = 0
+	ebcdic                uint8  = 1
+	ieee                  uint8  = 0
+	vax                   uint8  = 1
+	cray                  uint8  = 2
+	ibm                   uint8  = 3
+)
+
+// Character encodings that can be selected in the NDR format label
+const (
+	CharacterEncodingASCII  = ascii
+	CharacterEncodingEBCDIC = ebcdic
 )
 
 // CommonHeader implements the NDR common header: https://msdn.microsoft.com/en-us/library/cc243889.aspx
@@ -45,6 +53,8 @@ type CommonHeader struct {
 	FloatRepresentation uint8
 	HeaderLength        uint16
 	Filler              []byte
+	TransferSyntax      []byte // RPC_SYNTAX_IDENTIFIER of the transfer syntax in a version 2 header
+	InterfaceID         []byte // Interface UUID and version in a version 2 header
 }
 
 // PrivateHeader implements the NDR private header: https://msdn.microsoft.com/en-us/library/cc243919.aspx
@@ -89,11 +99,13 @@ func (dec *Decoder) readCommonHeaderV1() error {
 	if endian != 0 && endian != 1 {
 		return Malformed{EText: "common header does not indicate a valid endianness"}
 	}
-	//dec.ch.CharacterEncoding = uint8(vb & 0xF)
-	dec.ch.CharacterEncoding = uint8(dec.ch.Version & 0xF)
-	if dec.ch.CharacterEncoding != 0 && dec.ch.CharacterEncoding != 1 {
+	charEncoding := uint8(eb & 0xF)
+	if charEncoding != ascii && charEncoding != ebcdic {
 		return Malformed{EText: "common header does not indicate a valid character encoding"}
 	}
+	if !dec.charEncodingSet {
+		dec.ch.CharacterEncoding = charEncoding
+	}
 	switch endian {
 	case littleEndian:
 		dec.ch.Endianness = binary.LittleEndian
@@ -135,7 +147,7 @@ func (dec *Decoder) readCommonHeaderV2() error {
 	}
 	dec.ch.HeaderLength = dec.ch.Endianness.Uint16(lb)
 	// CommonHeaderLength (2 bytes): Indicates the length in bytes of the common header. MUST be 0x40.
-	if dec.ch.HeaderLength != 0x40 {
+	if dec.ch.HeaderLength != commonHeaderV2Bytes {
 		//return Malformed{EText: "common header v2 does not indicate a valid length of 0x40"}
 		return Malformed{EText: fmt.Sprintf("common header v2 does not indicate a valid length of 0x40, but %x", dec.ch.HeaderLength)}
 	}
@@ -152,22 +164,30 @@ func (dec *Decoder) readCommonHeaderV2() error {
 	}
 
 	// TransferSyntax (20 bytes): RPC transfer syntax identifier used to encode data in the octet stream. It MUST use RPC_SYNTAX_IDENTIFIER format, as specified in section 2.2.2.7. It MUST be either the NDR transfer syntax identifier or the NDR64 transfer syntax identifier.
-	tsb, err := dec.readBytes(20)
+	dec.ch.TransferSyntax, err = dec.readBytes(20)
 	if err != nil {
 		return Malformed{EText: fmt.Sprintf("could not read common header v2 TransferSyntax bytes: %v", err)}
 	}
 
-	ndrUuid, err := uuid_to_bin("8a885d04-1ceb-11c9-9fe8-08002b104860") // NDR Transfer Syntax version 2.0
+	ndrSyntax, err := syntaxIdentifier(ndrTransferSyntaxUUID, 2, 0)
 	if err != nil {
 		return fmt.Errorf("Failed to convert NDRUuid string to bytes")
 	}
-	// Expect NDR and not NDR64
-	if !bytes.Equal(tsb, ndrUuid) {
-		return Malformed{EText: fmt.Sprintf("common header v2 invalid TransferSyntax bytes: %x", tsb)}
+	ndr64Syntax, err := syntaxIdentifier(ndr64TransferSyntaxUUID, 1, 0)
+	if err != nil {
+		return fmt.Errorf("Failed to convert NDR64Uuid string to bytes")
+	}
+	switch {
+	case bytes.Equal(dec.ch.TransferSyntax, ndrSyntax):
+		dec.ndr64 = false
+	case bytes.Equal(dec.ch.TransferSyntax, ndr64Syntax):
+		dec.ndr64 = true
+	default:
+		return Malformed{EText: fmt.Sprintf("common header v2 invalid TransferSyntax bytes: %x", dec.ch.TransferSyntax)}
 	}
 
 	//InterfaceID (20 bytes): Interface identifier, as specified in the IDL file. It MUST use the interface identifier format, as specified in [C706] section 3.1.9. Implementations MAY ignore the value of this field.<58>
-	_, err = dec.readBytes(20)
+	dec.ch.InterfaceID, err = dec.readBytes(20)
 	if err != nil {
 		return Malformed{EText: fmt.Sprintf("could not read common header v2 InterfaceID bytes: %v", err)}
 	}
@@ -216,23 +236,92 @@ func (dec *Decoder) readPrivateHeaderV2() error {
 	return nil
 }
 
-func (enc *Encoder) writeCommonHeader(w *bytes.Buffer) (err error) {
-	//Common header
-	binary.Write(w, binary.LittleEndian, uint8(1))
-	binary.Write(w, binary.LittleEndian, uint8(0x10))
-	binary.Write(w, binary.LittleEndian, uint16(0x0008))
-	binary.Write(w, binary.LittleEndian, uint32(0xCCCCCCCC))
-	return
+// syntaxIdentifier returns the 20 byte representation of a UUID followed by a major and minor version as used by both
+// the RPC_SYNTAX_IDENTIFIER and the interface identifier.
+func syntaxIdentifier(uuid string, major, minor uint16) ([]byte, error) {
+	b, err := uuid_to_bin(uuid)
+	if err != nil {
+		return nil, err
+	}
+	b = binary.LittleEndian.AppendUint16(b, major)
+	b = binary.LittleEndian.AppendUint16(b, minor)
+	return b, nil
+}
+
+func (enc *Encoder) writeCommonHeader(w *bytes.Buffer) error {
+	if enc.ndr64 && enc.ch.Version != 2 {
+		return fmt.Errorf("NDR64 requires a RPC Type serialization header of version 2")
+	}
+	switch enc.ch.Version {
+	case 1:
+		return enc.writeCommonHeaderV1(w)
+	case 2:
+		return enc.writeCommonHeaderV2(w)
+	default:
+		return fmt.Errorf("cannot write a RPC Type serialization header of version %d", enc.ch.Version)
+	}
+}
+
+func (enc *Encoder) writeCommonHeaderV1(w *bytes.Buffer) error {
+	endian := uint8(littleEndian)
+	if enc.ch.Endianness == binary.BigEndian {
+		endian = bigEndian
+	}
+	if enc.ch.CharacterEncoding != ascii && enc.ch.CharacterEncoding != ebcdic {
+		return fmt.Errorf("invalid character encoding: %d", enc.ch.CharacterEncoding)
+	}
+	w.WriteByte(protocolVersion)
+	// Endianness in the high nibble and character encoding in the low nibble
+	w.WriteByte(endian<<4 | enc.ch.CharacterEncoding)
+	binary.Write(w, enc.ch.Endianness, commonHeaderBytes)
+	binary.Write(w, enc.ch.Endianness, uint32(0xCCCCCCCC)) // Filler
+	return nil
+}
+
+func (enc *Encoder) writeCommonHeaderV2(w *bytes.Buffer) error {
+	//Endianness (1 byte): MUST be set to little-endian (0x10).
+	if enc.ch.Endianness != binary.LittleEndian {
+		return fmt.Errorf("a RPC Type serialization header of version 2 must be little-endian")
+	}
+	transferSyntax := enc.ch.TransferSyntax
+	if transferSyntax == nil {
+		var err error
+		if enc.ndr64 {
+			transferSyntax, err = syntaxIdentifier(ndr64TransferSyntaxUUID, 1, 0)
+		} else {
+			transferSyntax, err = syntaxIdentifier(ndrTransferSyntaxUUID, 2, 0)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	interfaceID := enc.ch.InterfaceID
+	if interfaceID == nil {
+		interfaceID = make([]byte, 20)
+	}
+	w.WriteByte(2)
+	w.WriteByte(0x10)
+	binary.Write(w, binary.LittleEndian, commonHeaderV2Bytes)
+	binary.Write(w, binary.LittleEndian, uint32(0xCCCCCCCC)) // endianInfo
+	w.Write(bytes.Repeat([]byte{0xCC}, 16))                  // Reserved
+	w.Write(transferSyntax)
+	w.Write(interfaceID)
+	return nil
 }
 
 func (enc *Encoder) writePrivateHeader(w *bytes.Buffer) (err error) {
 	//Private header
+	// The object buffer length must include the padding needed to reach a multiple of 8 bytes
 	bufLen := uint32(enc.w.Len())
 	bufferSize := ((bufLen + 7) / 8) * 8
 	padd := bufferSize - bufLen
-	binary.Write(enc.w, binary.LittleEndian, make([]byte, padd))
+	enc.w.Write(make([]byte, padd))
 
-	binary.Write(w, binary.LittleEndian, bufferSize)
-	binary.Write(w, binary.LittleEndian, uint32(0x00000000))
+	binary.Write(w, enc.ch.Endianness, bufferSize)
+	if enc.ch.Version == 2 {
+		w.Write(make([]byte, 12)) // Filler
+	} else {
+		w.Write(make([]byte, 4)) // Filler
+	}
 	return
 }
@@ -0,0 +1,242 @@
+package ndr
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+/*
+NDR64 transfer syntax
+https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-rpce/b3bdc9fa-7c1d-4ed1-9f2f-8e0ee3fc1e0e
+
+NDR64 differs from NDR 2.0 in the following ways handled here:
+- Referent IDs as well as conformance and variance counts are 8 bytes and aligned to 8 bytes.
+- A structure is aligned to the largest alignment of its members and padded at the end to a multiple of it.
+- The selected arm of a union is aligned to the largest alignment of all of the arms.
+- Enums are 4 bytes rather than 2 bytes.
+- __int3264 values are 8 bytes rather than 4 bytes.
+*/
+
+const (
+	ndr64TransferSyntaxUUID = "71710533-beba-4937-8319-b5dbef9ccc36" // NDR64 Transfer Syntax version 1.0
+	SizeNDR64Ptr            = 8
+	SizeNDR64Count          = 8
+	SizeNDR64Enum           = 4
+)
+
+// SetNDR64 selects whether the byte stream uses the NDR64 transfer syntax rather than NDR 2.0. This is needed to decode
+// stubs negotiated over NDR64 without a header as a version 2 header selects the transfer syntax itself.
+func (dec *Decoder) SetNDR64(b bool) {
+	dec.ndr64 = b
+}
+
+// SetNDR64 selects whether to encode using the NDR64 transfer syntax rather than NDR 2.0. As NDR64 requires a version 2
+// header, the header version is set to 2.
+func (enc *Encoder) SetNDR64(b bool) {
+	enc.ndr64 = b
+	if b {
+		enc.ch.Version = 2
+	}
+}
+
+// readPointer reads a referent ID which is 4 bytes in NDR and 8 bytes in NDR64.
+func (dec *Decoder) readPointer() (uint64, error) {
+	if !dec.ndr64 {
+		p, err := dec.readUint32()
+		return uint64(p), err
+	}
+	return dec.readUint64()
+}
+
+// readCount reads a conformance or variance count which is 4 bytes in NDR and 8 bytes in NDR64.
+func (dec *Decoder) readCount() (uint32, error) {
+	if !dec.ndr64 {
+		return dec.readUint32()
+	}
+	n, err := dec.readUint64()
+	if err != nil {
+		return 0, err
+	}
+	if n > math.MaxUint32 {
+		return 0, fmt.Errorf("count %d is too large", n)
+	}
+	return uint32(n), nil
+}
+
+// fillInt3264 reads an __int3264, which is 4 bytes in NDR and 8 bytes in NDR64, into a Go integer kind. Signed values
+// are sign extended.
+func (dec *Decoder) fillInt3264(v reflect.Value) error {
+	signed := v.CanInt()
+	var n uint64
+	if dec.ndr64 {
+		i, err := dec.readUint64()
+		if err != nil {
+			return err
+		}
+		n = i
+	} else if signed {
+		i, err := dec.readInt32()
+		if err != nil {
+			return err
+		}
+		n = uint64(int64(i))
+	} else {
+		i, err := dec.readUint32()
+		if err != nil {
+			return err
+		}
+		n = uint64(i)
+	}
+	return setInteger(v, n, signed)
+}
+
+// writeReferentID writes a referent ID, or zero for a NULL pointer, which is 4 bytes in NDR and 8 bytes in NDR64.
+func (enc *Encoder) writeReferentID(id uint32) error {
+	if enc.ndr64 {
+		return enc.writeUint64(uint64(id))
+	}
+	return enc.writeUint32(id)
+}
+
+// writeCount writes a conformance or variance count which is 4 bytes in NDR and 8 bytes in NDR64.
+func (enc *Encoder) writeCount(n uint32) error {
+	if enc.ndr64 {
+		return enc.writeUint64(uint64(n))
+	}
+	return enc.writeUint32(n)
+}
+
+// writeInt3264 writes a Go integer as an __int3264, which is 4 bytes in NDR and 8 bytes in NDR64.
+func (enc *Encoder) writeInt3264(v reflect.Value) error {
+	if enc.ndr64 {
+		if v.CanInt() {
+			return enc.writeInt64(v.Int())
+		}
+		return enc.writeUint64(v.Uint())
+	}
+	if v.CanInt() {
+		if v.Int() < math.MinInt32 || v.Int() > math.MaxInt32 {
+			return fmt.Errorf("value %d does not fit in an int3264 in NDR", v.Int())
+		}
+		return enc.writeInt32(int32(v.Int()))
+	}
+	if v.Uint() > math.MaxUint32 {
+		return fmt.Errorf("value %d does not fit in an int3264 in NDR", v.Uint())
+	}
+	return enc.writeUint32(uint32(v.Uint()))
+}
+
+// integerValue returns the value of the Go integer v.
+func integerValue(v reflect.Value) (int64, error) {
+	switch {
+	case v.CanInt():
+		return v.Int(), nil
+	case v.CanUint():
+		if v.Uint() > math.MaxInt64 {
+			return 0, fmt.Errorf("value %d is too large", v.Uint())
+		}
+		return int64(v.Uint()), nil
+	default:
+		return 0, fmt.Errorf("%v is not an integer", v.Type())
+	}
+}
+
+// setInteger sets the Go integer v to n and returns an error if n overflows v.
+func setInteger(v reflect.Value, n uint64, signed bool) error {
+	switch {
+	case v.CanInt():
+		i := int64(n)
+		if !signed && i < 0 || v.OverflowInt(i) {
+			return fmt.Errorf("value %d overflows %v", n, v.Type())
+		}
+		v.SetInt(i)
+	case v.CanUint():
+		if signed && int64(n) < 0 || v.OverflowUint(n) {
+			return fmt.Errorf("value %d overflows %v", int64(n), v.Type())
+		}
+		v.SetUint(n)
+	default:
+		return fmt.Errorf("%v is not an integer", v.Type())
+	}
+	return nil
+}
+
+// ndr64Alignment returns the NDR64 alignment of a value of type t with the tag, which is the largest alignment of the
+// primitives it is made of.
+func ndr64Alignment(t reflect.Type, tag reflect.StructTag) int {
+	ndrTag := parseTags(tag)
+	if ndrTag.HasValue(TagPointer) || ndrTag.HasValue(TagPipe) || ndrTag.HasValue(TagInt3264) {
+		return SizeNDR64Ptr
+	}
+	if ndrTag.HasValue(TagTopLevelPointer) {
+		if ndrTag.HasValue(TagFullPointer) {
+			return SizeNDR64Ptr
+		}
+		ndrTag.delete(TagTopLevelPointer)
+		return ndr64Alignment(t, ndrTag.StructTag())
+	}
+	if ndrTag.HasValue(TagV1Enum) {
+		return SizeV1Enum
+	}
+	if ndrTag.HasValue(TagEnum) {
+		return SizeNDR64Enum
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.Uint8, reflect.Int8:
+		return SizeUint8
+	case reflect.Uint16, reflect.Int16:
+		return SizeUint16
+	case reflect.Uint32, reflect.Int32, reflect.Float32:
+		return SizeUint32
+	case reflect.Uint64, reflect.Int64, reflect.Float64:
+		return SizeUint64
+	case reflect.String:
+		if isFixedString(tag) {
+			if isCharString(tag) {
+				return SizeUint8
+			}
+			return SizeUint16
+		}
+		// Strings are varying so carry counts
+		return SizeNDR64Count
+	case reflect.Slice:
+		if t.Implements(reflect.TypeOf(new(RawBytes)).Elem()) && t.Elem().Kind() == reflect.Uint8 {
+			return SizeUint8
+		}
+		// Slices are conformant or varying arrays so carry counts
+		return SizeNDR64Count
+	case reflect.Array:
+		if isElementPointer(tag) {
+			return SizeNDR64Ptr
+		}
+		return ndr64Alignment(t.Elem(), reflect.StructTag(""))
+	case reflect.Struct:
+		a := 1
+		for i := 0; i < t.NumField(); i++ {
+			if n := ndr64Alignment(t.Field(i).Type, t.Field(i).Tag); n > a {
+				a = n
+			}
+		}
+		return a
+	}
+	return 1
+}
+
+// unionArmAlignment returns the largest NDR64 alignment of the arms of the union t.
+func unionArmAlignment(t reflect.Type) int {
+	a := 1
+	for i := 0; i < t.NumField(); i++ {
+		ndrTag := parseTags(t.Field(i).Tag)
+		if !ndrTag.HasValue(TagUnionField) {
+			continue
+		}
+		if n := ndr64Alignment(t.Field(i).Type, t.Field(i).Tag); n > a {
+			a = n
+		}
+	}
+	return a
+}
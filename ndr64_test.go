@@ -0,0 +1,148 @@
+package ndr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testNDR64Header = "02104000cccccccc" + "cccccccccccccccccccccccccccccccc" +
+		"33057171babe37498319b5dbef9ccc3601000000" + // NDR64 transfer syntax
+		"0000000000000000000000000000000000000000" + // Interface ID
+		"18000000000000000000000000000000" + // Private header with length 24
+		"0000020000000000" // Top-level referent
+	testNDR64Stub = "0100" + "000000000000" + // A with padding to the 8 byte pointer
+		"0000020000000000" + "0400020000000000" + // P and S
+		"03000000" + "00000000" + // E as a 4 byte enum with padding
+		"feffffffffffffff" + // I as an 8 byte int3264
+		"05" + "00000000000000" + // B with trailing padding of the structure
+		"07000000" + // referent of P
+		"00000000" + "0200000000000000" + "0000000000000000" + "0200000000000000" + "61000000" // referent of S
+	testNDR64Union = "0100" + "000000000000" + "2a" + "00000000000000"
+)
+
+type testNDR64 struct {
+	A uint16
+	P *uint32 `ndr:"pointer"`
+	S string  `ndr:"pointer,conformant,varying"`
+	E uint16  `ndr:"enum"`
+	I int64   `ndr:"int3264"`
+	B uint8
+}
+
+type testNDR64UnionEncapsulated struct {
+	Tag   uint16 `ndr:"unionTag,encapsulated"`
+	Small uint8  `ndr:"unionField"`
+	Big   uint64 `ndr:"unionField"`
+}
+
+func (u testNDR64UnionEncapsulated) SwitchFunc(tag interface{}) string {
+	switch tag.(uint16) {
+	case 1:
+		return "Small"
+	case 2:
+		return "Big"
+	}
+	return ""
+}
+
+func TestReadNDR64(t *testing.T) {
+	b, _ := hex.DecodeString(testNDR64Stub)
+	dec := NewDecoder(bytes.NewReader(b), false)
+	dec.SetNDR64(true)
+	d := new(testNDR64)
+	err := dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, uint16(1), d.A, "value not as expected")
+	assert.Equal(t, uint32(7), *d.P, "value not as expected")
+	assert.Equal(t, "a", d.S, "value not as expected")
+	assert.Equal(t, uint16(3), d.E, "value not as expected")
+	assert.Equal(t, int64(-2), d.I, "value not as expected")
+	assert.Equal(t, uint8(5), d.B, "value not as expected")
+}
+
+func TestReadNDR64Header(t *testing.T) {
+	b, _ := hex.DecodeString(testNDR64Header + testNDR64Union)
+	dec := NewDecoder(bytes.NewReader(b), true)
+	d := new(testNDR64UnionEncapsulated)
+	err := dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, uint16(1), d.Tag, "value not as expected")
+	assert.Equal(t, uint8(0x2a), d.Small, "value not as expected")
+}
+
+func TestReadInt3264NDR(t *testing.T) {
+	b, _ := hex.DecodeString("feffffff")
+	dec := NewDecoder(bytes.NewReader(b), false)
+	d := new(struct {
+		I int64 `ndr:"int3264"`
+	})
+	err := dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, int64(-2), d.I, "value not as expected")
+}
+
+func TestWriteNDR64(t *testing.T) {
+	p := uint32(7)
+	a := testNDR64{A: 1, P: &p, S: "a", E: 3, I: -2, B: 5}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	enc.SetNDR64(true)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, testNDR64Stub, hex.EncodeToString(b), "encoded bytes not as expected")
+}
+
+func TestWriteNDR64Header(t *testing.T) {
+	a := testNDR64UnionEncapsulated{Tag: 1, Small: 0x2a}
+	enc := NewEncoder(new(bytes.Buffer), true)
+	enc.SetNDR64(true)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, testNDR64Header+testNDR64Union, hex.EncodeToString(b), "encoded bytes not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), true)
+	d := new(testNDR64UnionEncapsulated)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "value not as expected after round trip")
+}
+
+func TestWriteNDR64HeaderVersion1(t *testing.T) {
+	enc := NewEncoder(new(bytes.Buffer), true)
+	enc.SetNDR64(true)
+	enc.SetHeaderVersion(1)
+	_, err := enc.Encode(&testNDR64UnionEncapsulated{Tag: 1})
+	assert.Error(t, err, "expected error for NDR64 with a version 1 header")
+}
+
+func TestNDR64RoundTrip(t *testing.T) {
+	a := testElementPointerStrings{Count: 2, Names: []string{"ab", "c"}}
+	enc := NewEncoder(new(bytes.Buffer), true)
+	enc.SetNDR64(true)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	dec := NewDecoder(bytes.NewReader(b), true)
+	d := new(testElementPointerStrings)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "value not as expected after round trip")
+}
@@ -6,20 +6,26 @@ import (
 )
 
 func (dec *Decoder) fillPipe(v reflect.Value, tag reflect.StructTag) error {
-	s, err := dec.readUint32() // read element count of first chunk
+	s, err := dec.readCount() // read element count of first chunk
 	if err != nil {
 		return err
 	}
 	a := reflect.MakeSlice(v.Type(), 0, 0)
 	c := reflect.MakeSlice(v.Type(), int(s), int(s))
 	for s != 0 {
+		// The referents of any embedded pointers follow the elements of the chunk
+		var def []deferedPtr
 		for i := 0; i < int(s); i++ {
-			err := dec.fill(c.Index(i), tag, &[]deferedPtr{})
+			err := dec.fill(c.Index(i), tag, &def)
 			if err != nil {
 				return fmt.Errorf("could not fill element %d of pipe: %v", i, err)
 			}
 		}
-		s, err = dec.readUint32() // read element count of first chunk
+		err = dec.processDeferred(def)
+		if err != nil {
+			return fmt.Errorf("could not fill pipe: %v", err)
+		}
+		s, err = dec.readCount() // read element count of first chunk
 		if err != nil {
 			return err
 		}
@@ -29,3 +35,38 @@ func (dec *Decoder) fillPipe(v reflect.Value, tag reflect.StructTag) error {
 	v.Set(a)
 	return nil
 }
+
+// writePipe writes the slice as a pipe. The elements are split into chunks of at most the configured pipe chunk size,
+// each chunk preceded by its element count and followed by the referents of any embedded pointers, and the pipe is
+// terminated by an empty chunk.
+func (enc *Encoder) writePipe(v reflect.Value, tag reflect.StructTag) error {
+	n := v.Len()
+	size := enc.pipeChunkSize
+	if size <= 0 || size > n {
+		size = n
+	}
+	for i := 0; i < n; i += size {
+		end := i + size
+		if end > n {
+			end = n
+		}
+		err := enc.writeCount(uint32(end - i)) // element count of chunk
+		if err != nil {
+			return err
+		}
+		// The referents of any embedded pointers follow the elements of the chunk
+		var def []deferedPtr
+		for j := i; j < end; j++ {
+			err := enc.fill(v.Index(j), tag, &def)
+			if err != nil {
+				return fmt.Errorf("could not write element %d of pipe: %v", j, err)
+			}
+		}
+		err = enc.processDeferred(def)
+		if err != nil {
+			return fmt.Errorf("could not write pipe: %v", err)
+		}
+	}
+	// terminating chunk
+	return enc.writeCount(0)
+}
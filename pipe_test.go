@@ -18,7 +18,7 @@ func TestFillPipe(t *testing.T) {
 	hexStr := TestHeader + testPipe
 	b, _ := hex.DecodeString(hexStr)
 	a := new(structWithPipe)
-	dec := NewDecoder(bytes.NewReader(b))
+	dec := NewDecoder(bytes.NewReader(b), true)
 	err := dec.Decode(a)
 	if err != nil {
 		t.Fatalf("%v", err)
@@ -26,3 +26,72 @@ func TestFillPipe(t *testing.T) {
 	tp := []uint32{1, 2, 3, 4, 1, 2, 3}
 	assert.Equal(t, tp, a.A, "Value of pipe not as expected")
 }
+
+func TestWritePipe(t *testing.T) {
+	a := structWithPipe{A: []uint32{1, 2, 3, 4, 1, 2, 3}}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	enc.SetPipeChunkSize(4)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, testPipe, hex.EncodeToString(b), "Encoded pipe not as expected")
+}
+
+func TestWritePipeRoundTrip(t *testing.T) {
+	var tests = []struct {
+		chunkSize int
+		value     []uint32
+	}{
+		{0, []uint32{1, 2, 3, 4, 5}},
+		{1, []uint32{1, 2, 3}},
+		{2, []uint32{1, 2, 3, 4, 5}},
+		{4, []uint32{}},
+	}
+	for i, test := range tests {
+		enc := NewEncoder(new(bytes.Buffer), true)
+		enc.SetPipeChunkSize(test.chunkSize)
+		b, err := enc.Encode(&structWithPipe{A: test.value})
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		a := new(structWithPipe)
+		dec := NewDecoder(bytes.NewReader(b), true)
+		err = dec.Decode(a)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		assert.Equal(t, test.value, a.A, "Value of pipe not as expected for test %d", i)
+	}
+}
+
+type testPipeElement struct {
+	A uint32
+	B *uint32 `ndr:"pointer"`
+}
+
+type structWithPointerPipe struct {
+	P []testPipeElement `ndr:"pipe"`
+}
+
+func TestPipeEmbeddedPointers(t *testing.T) {
+	x, y := uint32(5), uint32(6)
+	a := structWithPointerPipe{P: []testPipeElement{{1, &x}, {2, &y}}}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	enc.SetPipeChunkSize(1)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// count:A:B:referent of B for each chunk:terminating chunk
+	assert.Equal(t, "01000000"+"01000000"+"00000200"+"05000000"+"01000000"+"02000000"+"04000200"+"06000000"+"00000000",
+		hex.EncodeToString(b), "Encoded pipe not as expected")
+
+	d := new(structWithPointerPipe)
+	dec := NewDecoder(bytes.NewReader(b), false)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "Value of pipe not as expected after round trip")
+}
@@ -0,0 +1,157 @@
+package ndr
+
+import (
+	"fmt"
+	"reflect"
+)
+
+/*
+Full pointers
+
+An embedded pointer tagged with both "pointer" and "fullpointer" is handled as an IDL [ptr] pointer. Unlike unique
+pointers, several full pointers may point to the same referent. All of them are represented by the same referent ID
+and the referent is only marshalled once, after the first pointer it was seen with.
+
+When encoding, two full pointers alias when they are the same Go pointer. When decoding, every pointer carrying an
+already seen referent ID is set to the Go pointer created for the first one. As a referent is only ever deferred once,
+cyclic structures terminate.
+Full pointers must be represented by Go pointers as aliasing cannot be expressed with values.
+*/
+
+// defaultMaxDepth is the default max nesting depth of deferred referents.
+const defaultMaxDepth = 1024
+
+// referentKey identifies the referent of a full pointer when encoding. The type is included as a struct and its first
+// field share the same address.
+type referentKey struct {
+	addr uintptr
+	t    reflect.Type
+}
+
+func isFullPointerTag(ndrTag tags) bool {
+	return ndrTag.HasValue(TagPointer) && ndrTag.HasValue(TagFullPointer) && !ndrTag.HasValue(TagTopLevelPointer)
+}
+
+func (enc *Encoder) isFullPointer(s interface{}, tag reflect.StructTag, def *[]deferedPtr) (bool, error) {
+	ndrTag := parseTags(tag)
+	if !isFullPointerTag(ndrTag) {
+		return false, nil
+	}
+	ndrTag.delete(TagPointer)
+	ndrTag.delete(TagFullPointer)
+	r, ok := s.(reflect.Value)
+	if !ok || r.Kind() != reflect.Pointer {
+		return true, fmt.Errorf("a full pointer must be a Go pointer")
+	}
+	if r.IsNil() {
+		err := enc.writeReferentID(0)
+		if err != nil {
+			return true, fmt.Errorf("could not write empty pointer: %v", err)
+		}
+		return true, nil
+	}
+	key := referentKey{addr: r.Pointer(), t: r.Type()}
+	if id, ok := enc.referents[key]; ok {
+		// The referent has already been seen so only the referent ID is written
+		err := enc.writeReferentID(id)
+		if err != nil {
+			return true, fmt.Errorf("could not write pointer: %v", err)
+		}
+		return true, nil
+	}
+	id := enc.newReferentID()
+	err := enc.writeReferentID(id)
+	if err != nil {
+		return true, fmt.Errorf("could not write pointer: %v", err)
+	}
+	if enc.referents == nil {
+		enc.referents = make(map[referentKey]uint32)
+	}
+	enc.referents[key] = id
+	*def = append(*def, deferedPtr{v: r, tag: ndrTag.StructTag(), p: uint64(id)})
+	return true, nil
+}
+
+func (dec *Decoder) isFullPointer(s interface{}, tag reflect.StructTag, def *[]deferedPtr) (bool, error) {
+	ndrTag := parseTags(tag)
+	if !isFullPointerTag(ndrTag) {
+		return false, nil
+	}
+	ndrTag.delete(TagPointer)
+	ndrTag.delete(TagFullPointer)
+	r, ok := s.(reflect.Value)
+	if !ok || r.Kind() != reflect.Pointer {
+		return true, fmt.Errorf("a full pointer must be a Go pointer")
+	}
+	p, err := dec.readPointer()
+	if err != nil {
+		return true, fmt.Errorf("could not read pointer: %v", err)
+	}
+	if p == 0 {
+		return true, nil
+	}
+	if referent, ok := dec.referents[p]; ok {
+		// The referent has already been seen so alias it rather than reading it again
+		if referent.Type() != r.Type() {
+			return true, fmt.Errorf("referent ID 0x%x is shared by pointers of type %v and %v", p, referent.Type(), r.Type())
+		}
+		r.Set(referent)
+		return true, nil
+	}
+	if r.IsNil() {
+		r.Set(reflect.New(r.Type().Elem()))
+	}
+	if dec.referents == nil {
+		dec.referents = make(map[uint64]reflect.Value)
+	}
+	dec.referents[p] = reflect.ValueOf(r.Interface())
+	*def = append(*def, deferedPtr{r, ndrTag.StructTag(), p})
+	return true, nil
+}
+
+// isRecursive reports whether the type the pointer type t points to contains itself, such as the next pointer of the
+// node of a linked list.
+func isRecursive(t reflect.Type) bool {
+	return containsType(t.Elem(), t.Elem(), make(map[reflect.Type]bool))
+}
+
+func containsType(t, target reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		return t.Elem() == target || containsType(t.Elem(), target, seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).Type == target || containsType(t.Field(i).Type, target, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isElementPointer reports whether the elements of the array with the tag are embedded pointers.
+func isElementPointer(tag reflect.StructTag) bool {
+	ndrTag := parseTags(tag)
+	return ndrTag.Map[TagElement] == TagPointer
+}
+
+// elementTag returns the tag to fill the element e of an array with the tag. Elements of an array tagged with
+// elem:pointer are embedded pointers which referents are deferred after the whole array in element order. The referent
+// of a string element is a conformant varying string.
+func elementTag(tag reflect.StructTag, e reflect.Value) reflect.StructTag {
+	if !isElementPointer(tag) {
+		return tag
+	}
+	t := e.Type()
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.String {
+		return reflect.StructTag(`ndr:"pointer,conformant,varying"`)
+	}
+	return reflect.StructTag(`ndr:"pointer"`)
+}
@@ -0,0 +1,387 @@
+package ndr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testFullPointerNode struct {
+	Value uint32
+	Next  *testFullPointerNode `ndr:"pointer,fullpointer"`
+}
+
+type testFullPointers struct {
+	A *testFullPointerNode `ndr:"pointer,fullpointer"`
+	B *testFullPointerNode `ndr:"pointer,fullpointer"`
+	C *testFullPointerNode `ndr:"pointer,fullpointer"`
+}
+
+type testFullPointerMismatch struct {
+	A *testFullPointerNode `ndr:"pointer,fullpointer"`
+	B *uint32              `ndr:"pointer,fullpointer"`
+}
+
+func TestWriteFullPointerAliasing(t *testing.T) {
+	n := &testFullPointerNode{Value: 1}
+	a := testFullPointers{A: n, B: n}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// A:B sharing the referent ID:C NULL:referent of A and B
+	assert.Equal(t, "00000200"+"00000200"+"00000000"+"01000000"+"00000000", hex.EncodeToString(b), "encoded bytes not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), false)
+	d := new(testFullPointers)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Same(t, d.A, d.B, "full pointers sharing a referent ID should alias")
+	assert.Equal(t, uint32(1), d.A.Value, "value not as expected")
+}
+
+func TestWriteFullPointerCycle(t *testing.T) {
+	n1 := &testFullPointerNode{Value: 1}
+	n2 := &testFullPointerNode{Value: 2, Next: n1}
+	n1.Next = n2
+	a := testFullPointers{A: n1, B: n2}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// A:B:C NULL:referent of A pointing to B:referent of B pointing to A
+	assert.Equal(t, "00000200"+"04000200"+"00000000"+"01000000"+"04000200"+"02000000"+"00000200", hex.EncodeToString(b), "encoded bytes not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), false)
+	d := new(testFullPointers)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Same(t, d.B, d.A.Next, "cycle not restored")
+	assert.Same(t, d.A, d.B.Next, "cycle not restored")
+	assert.Equal(t, uint32(2), d.A.Next.Value, "value not as expected")
+}
+
+func TestFullPointerReuse(t *testing.T) {
+	n := &testFullPointerNode{Value: 1}
+	a := testFullPointers{A: n, B: n}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l := len(b)
+	// The referent of the first message must not be aliased by the second
+	b, err = enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	e, err := NewEncoder(new(bytes.Buffer), false).Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, hex.EncodeToString(e), hex.EncodeToString(b[l:]), "second message not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), false)
+	d1 := new(testFullPointers)
+	err = dec.Decode(d1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	d2 := new(testFullPointers)
+	err = dec.Decode(d2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Same(t, d2.A, d2.B, "full pointers sharing a referent ID should alias")
+	assert.NotSame(t, d1.A, d2.A, "full pointers should not alias a referent of an earlier message")
+}
+
+func TestReadFullPointerTypeMismatch(t *testing.T) {
+	b, _ := hex.DecodeString("00000200" + "00000200" + "01000000" + "00000000")
+	dec := NewDecoder(bytes.NewReader(b), false)
+	d := new(testFullPointerMismatch)
+	err := dec.Decode(d)
+	assert.Error(t, err, "expected error for a referent ID shared by different types")
+}
+
+type testUniquePointers struct {
+	A *uint32                  `ndr:"pointer"`
+	B *uint32                  `ndr:"pointer"`
+	S *string                  `ndr:"pointer,conformant,varying"`
+	T *string                  `ndr:"pointer,conformant,varying"`
+	L []uint32                 `ndr:"pointer,conformant"`
+	M []uint32                 `ndr:"pointer,conformant"`
+	N *testUniquePointerNested `ndr:"pointer"`
+}
+
+type testUniquePointerNested struct {
+	P *uint32 `ndr:"pointer"`
+	Q *uint32 `ndr:"pointer"`
+}
+
+func TestUniquePointerNull(t *testing.T) {
+	var zero uint32
+	var empty string
+	a := testUniquePointers{
+		B: &zero,
+		T: &empty,
+		M: []uint32{},
+		N: &testUniquePointerNested{Q: &zero},
+	}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// A:B:S:T:L:M:N:referent of B:referent of T:padding:referent of M:referent of N:referent of N.Q
+	expected := "00000000" + "00000200" + "00000000" + "04000200" + "00000000" + "08000200" + "0c000200" + "00000000" +
+		"01000000" + "00000000" + "01000000" + "0000" + "0000" + "00000000" + "00000000" + "10000200" + "00000000"
+	assert.Equal(t, expected, hex.EncodeToString(b), "encoded bytes not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), false)
+	dec.SetNilPointers(true)
+	d := new(testUniquePointers)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Nil(t, d.A, "NULL pointer should be nil")
+	assert.Nil(t, d.S, "NULL pointer should be nil")
+	assert.Nil(t, d.L, "NULL pointer should be nil")
+	assert.Nil(t, d.N.P, "NULL pointer should be nil")
+	assert.Equal(t, &zero, d.B, "referent not as expected")
+	assert.Equal(t, &empty, d.T, "referent not as expected")
+	assert.Equal(t, []uint32{}, d.M, "referent not as expected")
+	assert.Equal(t, &zero, d.N.Q, "referent not as expected")
+
+	// By default NULL pointers are decoded as pointers to zero values
+	dec = NewDecoder(bytes.NewReader(b), false)
+	d = new(testUniquePointers)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, &zero, d.A, "referent not as expected")
+}
+
+type testDoublePointer struct {
+	A **uint32 `ndr:"pointer,pointer"`
+	B **uint32 `ndr:"pointer,pointer"`
+	C uint32
+}
+
+type testDoublePointerTopLevel struct {
+	A **uint32 `ndr:"toppointer,pointer"`
+	B uint32
+}
+
+func TestDoublePointer(t *testing.T) {
+	v := uint32(5)
+	p := &v
+	var np *uint32
+	a := testDoublePointer{A: &p, B: &np, C: 7}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// A:B:C:referent of A pointing to 5:referent of B being NULL
+	assert.Equal(t, "00000200"+"04000200"+"07000000"+"08000200"+"05000000"+"00000000", hex.EncodeToString(b), "encoded bytes not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), false)
+	dec.SetNilPointers(true)
+	d := new(testDoublePointer)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, uint32(5), **d.A, "referent not as expected")
+	assert.NotNil(t, d.B, "outer pointer should not be nil")
+	assert.Nil(t, *d.B, "NULL inner pointer should be nil")
+	assert.Equal(t, uint32(7), d.C, "value not as expected")
+}
+
+func TestDoublePointerTopLevel(t *testing.T) {
+	v := uint32(5)
+	p := &v
+	a := testDoublePointerTopLevel{A: &p, B: 7}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// The top-level reference pointer has no representation so A is the inner pointer directly followed by its referent
+	assert.Equal(t, "00000200"+"05000000"+"07000000", hex.EncodeToString(b), "encoded bytes not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), false)
+	dec.SetNilPointers(true)
+	d := new(testDoublePointerTopLevel)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, uint32(5), **d.A, "referent not as expected")
+	assert.Equal(t, uint32(7), d.B, "value not as expected")
+}
+
+type testListNode struct {
+	Value uint32
+	Next  *testListNode `ndr:"pointer"`
+}
+
+type testTreeNode struct {
+	Value uint32
+	Left  *testTreeNode `ndr:"pointer"`
+	Right *testTreeNode `ndr:"pointer"`
+}
+
+func TestLinkedList(t *testing.T) {
+	a := testListNode{Value: 1, Next: &testListNode{Value: 2, Next: &testListNode{Value: 3}}}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, "01000000"+"00000200"+"02000000"+"04000200"+"03000000"+"00000000", hex.EncodeToString(b), "encoded bytes not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), false)
+	d := new(testListNode)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "list not as expected after round trip")
+	assert.Nil(t, d.Next.Next.Next, "NULL pointer should terminate the list")
+}
+
+func TestTree(t *testing.T) {
+	a := testTreeNode{
+		Value: 1,
+		Left:  &testTreeNode{Value: 2, Left: &testTreeNode{Value: 4}},
+		Right: &testTreeNode{Value: 3},
+	}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// The referents of a node's pointers follow the node, depth first
+	expected := "01000000" + "00000200" + "04000200" +
+		"02000000" + "08000200" + "00000000" +
+		"04000000" + "00000000" + "00000000" +
+		"03000000" + "00000000" + "00000000"
+	assert.Equal(t, expected, hex.EncodeToString(b), "encoded bytes not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), false)
+	d := new(testTreeNode)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "tree not as expected after round trip")
+}
+
+func TestMaxDepth(t *testing.T) {
+	a := testListNode{Value: 1, Next: &testListNode{Value: 2, Next: &testListNode{Value: 3}}}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	enc.SetMaxDepth(1)
+	_, err := enc.Encode(&a)
+	assert.Error(t, err, "expected error for list deeper than the max depth")
+
+	b, _ := hex.DecodeString("01000000" + "00000200" + "02000000" + "04000200" + "03000000" + "00000000")
+	dec := NewDecoder(bytes.NewReader(b), false)
+	dec.SetMaxDepth(1)
+	err = dec.Decode(new(testListNode))
+	assert.Error(t, err, "expected error for list deeper than the max depth")
+
+	dec = NewDecoder(bytes.NewReader(b), false)
+	dec.SetMaxDepth(2)
+	err = dec.Decode(new(testListNode))
+	assert.NoError(t, err, "list within the max depth should decode")
+}
+
+type testElementPointers struct {
+	Values []*uint32 `ndr:"conformant,elem:pointer"`
+}
+
+type testElementPointerStrings struct {
+	Count uint32
+	Names []string `ndr:"pointer,conformant,elem:pointer"`
+}
+
+type testElementPointerFixed struct {
+	Values [2]*uint32 `ndr:"elem:pointer"`
+	A      uint32
+}
+
+func TestElementPointers(t *testing.T) {
+	v1, v3 := uint32(1), uint32(3)
+	a := testElementPointers{Values: []*uint32{&v1, nil, &v3}}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// max count:element pointers:referents in element order
+	assert.Equal(t, "03000000"+"00000200"+"00000000"+"04000200"+"01000000"+"03000000", hex.EncodeToString(b), "encoded bytes not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), false)
+	dec.SetNilPointers(true)
+	d := new(testElementPointers)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "value not as expected after round trip")
+}
+
+func TestElementPointerStrings(t *testing.T) {
+	a := testElementPointerStrings{Count: 2, Names: []string{"ab", "c"}}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// Count:pointer to array:max count:element pointers:referents of the elements as conformant varying strings
+	expected := "02000000" + "00000200" + "02000000" + "04000200" + "08000200" +
+		"03000000" + "00000000" + "03000000" + "610062000000" + "0000" +
+		"02000000" + "00000000" + "02000000" + "63000000"
+	assert.Equal(t, expected, hex.EncodeToString(b), "encoded bytes not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), false)
+	d := new(testElementPointerStrings)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "value not as expected after round trip")
+}
+
+func TestElementPointerFixedArray(t *testing.T) {
+	v1 := uint32(1)
+	a := testElementPointerFixed{Values: [2]*uint32{nil, &v1}, A: 5}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// The referents are deferred after the structure containing the array
+	assert.Equal(t, "00000000"+"00000200"+"05000000"+"01000000", hex.EncodeToString(b), "encoded bytes not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), false)
+	dec.SetNilPointers(true)
+	d := new(testElementPointerFixed)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "value not as expected after round trip")
+}
@@ -3,6 +3,7 @@ package ndr
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"math"
 )
 
@@ -15,6 +16,7 @@ const (
 	SizeUint32 = 4
 	SizeUint64 = 8
 	SizeEnum   = 2
+	SizeV1Enum = 4
 	SizeSingle = 4
 	SizeDouble = 8
 	SizePtr    = 4
@@ -177,6 +179,16 @@ func (dec *Decoder) readInt64() (int64, error) {
 
 // https://en.wikipedia.org/wiki/IEEE_754-1985
 func (dec *Decoder) readFloat32() (f float32, err error) {
+	if dec.ch.FloatRepresentation != ieee {
+		x, err := dec.readFloat(SizeSingle)
+		if err != nil {
+			return 0, err
+		}
+		if math.Abs(x) > math.MaxFloat32 {
+			return 0, fmt.Errorf("%g is out of range of a float32", x)
+		}
+		return float32(x), nil
+	}
 	dec.ensureAlignment(SizeSingle)
 	b, err := dec.readBytes(SizeSingle)
 	if err != nil {
@@ -188,6 +200,9 @@ func (dec *Decoder) readFloat32() (f float32, err error) {
 }
 
 func (dec *Decoder) readFloat64() (f float64, err error) {
+	if dec.ch.FloatRepresentation != ieee {
+		return dec.readFloat(SizeDouble)
+	}
 	dec.ensureAlignment(SizeDouble)
 	b, err := dec.readBytes(SizeDouble)
 	if err != nil {
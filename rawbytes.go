@@ -59,3 +59,20 @@ func (dec *Decoder) readRawBytes(v reflect.Value, tag reflect.StructTag) error {
 	v.Set(reflect.ValueOf(b).Convert(v.Type()))
 	return nil
 }
+
+func (enc *Encoder) writeRawBytes(v reflect.Value, tag reflect.StructTag) error {
+	ndrTag := parseTags(tag)
+	sizeStr, ok := ndrTag.Map["size"]
+	if !ok {
+		return errors.New("size tag not available")
+	}
+	size, err := strconv.Atoi(sizeStr)
+	if err != nil {
+		return fmt.Errorf("size not valid: %v", err)
+	}
+	if v.Len() != size {
+		return fmt.Errorf("length of raw bytes (%d) does not match the size %d", v.Len(), size)
+	}
+	_, err = enc.w.Write(v.Bytes())
+	return err
+}
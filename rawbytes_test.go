@@ -0,0 +1,59 @@
+package ndr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testRawBytes []byte
+
+func (b testRawBytes) Size(parent interface{}) int {
+	return int(parent.(structWithRawBytes).Len)
+}
+
+type structWithRawBytes struct {
+	Len uint32
+	A   testRawBytes
+	B   testRawBytes `ndr:"pointer"`
+	C   uint32
+}
+
+func TestWriteRawBytes(t *testing.T) {
+	a := structWithRawBytes{
+		Len: 3,
+		A:   testRawBytes{0xaa, 0xbb, 0xcc},
+		B:   testRawBytes{0xdd, 0xee, 0xff},
+		C:   5,
+	}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// Len:A:alignment:ptr to B:C:deferred B
+	assert.Equal(t, "03000000"+"aabbcc"+"00"+"00000200"+"05000000"+"ddeeff", hex.EncodeToString(b), "encoded raw bytes not as expected")
+
+	d := new(structWithRawBytes)
+	dec := NewDecoder(bytes.NewReader(b), false)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "raw bytes not as expected after round trip")
+}
+
+func TestWriteRawBytesSizeMismatch(t *testing.T) {
+	a := structWithRawBytes{
+		Len: 4,
+		A:   testRawBytes{0xaa, 0xbb, 0xcc},
+		B:   testRawBytes{0xdd, 0xee, 0xff, 0x00},
+	}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	_, err := enc.Encode(&a)
+	if err == nil {
+		t.Errorf("expected error when length of raw bytes does not match the size")
+	}
+}
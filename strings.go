@@ -5,7 +5,8 @@ import (
 	"encoding/binary"
 	"fmt"
 	"reflect"
-	"unicode/utf16"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -13,43 +14,26 @@ const (
 	subStringArrayValue = "X-subStringArray"
 )
 
-func uint16SliceToString(a []uint16) string {
-	s := make([]rune, len(a), len(a))
-	for i := range s {
-		s[i] = rune(a[i])
-	}
-	if len(s) > 0 {
-		// Remove any null terminator
-		if s[len(s)-1] == rune(0) {
-			s = s[:len(s)-1]
-		}
-	}
-	return string(s)
-}
-
-func (dec *Decoder) readVaryingString(def *[]deferedPtr) (string, error) {
+func (dec *Decoder) readVaryingString(tag reflect.StructTag, def *[]deferedPtr) (string, error) {
 	a := new([]uint16)
 	v := reflect.ValueOf(a)
-	var t reflect.StructTag
+	t := correlationTag(tag)
 	err := dec.fillUniDimensionalVaryingArray(v.Elem(), t, def)
 	if err != nil {
 		return "", err
 	}
-	s := uint16SliceToString(*a)
-	return s, nil
+	return decodeUTF16(trimNull(*a), dec.utf16Policy)
 }
 
-func (dec *Decoder) readConformantVaryingString(def *[]deferedPtr) (string, error) {
+func (dec *Decoder) readConformantVaryingString(tag reflect.StructTag, def *[]deferedPtr) (string, error) {
 	a := new([]uint16)
 	v := reflect.ValueOf(a)
-	var t reflect.StructTag
+	t := correlationTag(tag)
 	err := dec.fillUniDimensionalConformantVaryingArray(v.Elem(), t, def)
 	if err != nil {
 		return "", err
 	}
-	s := uint16SliceToString(*a)
-	//fmt.Printf("Read string: %q\n", s)
-	return s, nil
+	return decodeUTF16(trimNull(*a), dec.utf16Policy)
 }
 
 func (dec *Decoder) readStringsArray(v reflect.Value, tag reflect.StructTag, def *[]deferedPtr) error {
@@ -73,54 +57,180 @@ func (dec *Decoder) readStringsArray(v reflect.Value, tag reflect.StructTag, def
 	return nil
 }
 
+// stringCount returns the number of UTF-16 elements of the string including the null terminator.
+func stringCount(s string, p UTF16Policy) (uint32, error) {
+	l, err := utf16Len(s, p)
+	if err != nil {
+		return 0, err
+	}
+	n := uint32(l)
+	if !strings.HasSuffix(s, "\x00") {
+		n++
+	}
+	return n, nil
+}
+
+// countString returns the number of elements of the string with the tag including the null terminator, which is the
+// number of octets for an 8-bit character string and of UTF-16 elements otherwise.
+func (enc *Encoder) countString(s string, tag reflect.StructTag) (uint32, error) {
+	if isCharString(tag) {
+		return enc.charCount(s)
+	}
+	return stringCount(s, enc.utf16Policy)
+}
+
+// utf16Len returns the number of UTF-16 elements of the string.
+func utf16Len(s string, p UTF16Policy) (int, error) {
+	a, err := encodeUTF16(s, p)
+	if err != nil {
+		return 0, err
+	}
+	return len(a), nil
+}
+
+// stringArrayMaxCount returns the common max count of the strings within a, possibly multi-dimensional, string array.
+func stringArrayMaxCount(v reflect.Value, p UTF16Policy) (m uint32, err error) {
+	if v.Kind() == reflect.String {
+		return stringCount(v.String(), p)
+	}
+	for i := 0; i < v.Len(); i++ {
+		n, err := stringArrayMaxCount(v.Index(i), p)
+		if err != nil {
+			return 0, err
+		}
+		if n > m {
+			m = n
+		}
+	}
+	return
+}
+
+func (enc *Encoder) writeStringsArray(v reflect.Value, tag reflect.StructTag, def *[]deferedPtr) error {
+	// Any conformant max counts, including the common max of the strings, have already been written at the
+	// beginning of the structure so what remains is a varying array of varying strings.
+	tag = reflect.StructTag(subStringArrayTag)
+	err := enc.writeVaryingArray(v, tag, def)
+	if err != nil {
+		return fmt.Errorf("could not write string array: %v", err)
+	}
+	return nil
+}
+
+// ToUnicode returns the UTF-16 encoding of the string using the UTF-16 policy of the Encoder, except that it ignores
+// UTF16Strict: as no error can be returned, invalid sequences are replaced as with UTF16Replace. Use EncodeUTF16 to
+// get the error instead.
 func (enc *Encoder) ToUnicode(input string) []byte {
-	codePoints := utf16.Encode([]rune(input))
+	p := enc.utf16Policy
+	if p == UTF16Strict {
+		p = UTF16Replace
+	}
+	b, _ := enc.toUnicode(input, p)
+	return b
+}
+
+// EncodeUTF16 returns the UTF-16 encoding of the string using the UTF-16 policy of the Encoder, or an error for an
+// invalid sequence when the policy is UTF16Strict.
+func (enc *Encoder) EncodeUTF16(input string) ([]byte, error) {
+	return enc.toUnicode(input, enc.utf16Policy)
+}
+
+func (enc *Encoder) toUnicode(input string, p UTF16Policy) ([]byte, error) {
+	codePoints, err := encodeUTF16(input, p)
+	if err != nil {
+		return nil, err
+	}
 	b := bytes.Buffer{}
 	binary.Write(&b, enc.ch.Endianness, &codePoints)
-	return b.Bytes()
+	return b.Bytes(), nil
 }
 
 func (enc *Encoder) writeConformantVaryingString(s string) error {
-	var actualLen uint32
-	var unc []byte
-	//if s == "" {
-	//	s = "\x00"
-	//} else {
-	//	if !strings.HasSuffix(s, "\x00") {
-	//		// Add null byte
-	//		s += "\x00"
-	//	}
-	//}
-	unc = enc.ToUnicode(s)
-	actualLen = uint32(len(unc) / 2)
-
 	//NOTE according to NDR, strings should always be null terminated
 	// and both maxCount and actualLen should include the null terminator
-	//if s != "" {
-	//	unc = enc.ToUnicode(s)
-	//	maxLen = uint32(len(unc)/2)
-	//	if s[len(s)-1] == '\x00' {
-	//		actualLen = maxLen - 1 // without the null terminator
-	//	} else {
-	//		actualLen = maxLen
-	//	}
-	//}
-	enc.ensureAlignment(SizeUint32)
-	binary.Write(enc.w, enc.ch.Endianness, uint32(0)) // offset
-	binary.Write(enc.w, enc.ch.Endianness, actualLen)
-	binary.Write(enc.w, enc.ch.Endianness, unc)
+	err := enc.writeVaryingString(s)
+	if err != nil {
+		return err
+	}
 	enc.ensureAlignment(SizeUint32) // Need to align at 4 byte boundary even if uint16 comes after
 	return nil
 }
 
-//func (enc *Encoder) writeVaryingString(s string, def *[]deferedPtr) (error) {
-//	a := new([]uint16)
-//	v := reflect.ValueOf(a)
-//	var t reflect.StructTag
-//	err := enc.writeUniDimensionalVaryingArray(v.Elem(), t, def)
-//	if err != nil {
-//		return "", err
-//	}
-//	s := uint16SliceToString(*a)
-//	return s, nil
-//}
+func (enc *Encoder) writeVaryingString(s string) error {
+	a, err := encodeUTF16(s, enc.utf16Policy)
+	if err != nil {
+		return err
+	}
+	return enc.writeVaryingUnits(a)
+}
+
+// isFixedString reports whether a string with the tag is a fixed array, such as wchar_t Name[16].
+func isFixedString(tag reflect.StructTag) bool {
+	ndrTag := parseTags(tag)
+	_, ok := ndrTag.Map[TagFixed]
+	return ok
+}
+
+// fixedStringType returns the Go array type a string with the fixed tag is marshalled as.
+func fixedStringType(tag reflect.StructTag) (reflect.Type, error) {
+	ndrTag := parseTags(tag)
+	n, err := strconv.Atoi(ndrTag.Map[TagFixed])
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid %s length %q", TagFixed, ndrTag.Map[TagFixed])
+	}
+	if isCharString(tag) {
+		return reflect.ArrayOf(n, reflect.TypeOf(uint8(0))), nil
+	}
+	return reflect.ArrayOf(n, reflect.TypeOf(uint16(0))), nil
+}
+
+// readFixedString reads a fixed array holding a null padded string. The string is truncated at the first null.
+func (dec *Decoder) readFixedString(tag reflect.StructTag, def *[]deferedPtr) (string, error) {
+	t, err := fixedStringType(tag)
+	if err != nil {
+		return "", err
+	}
+	a := reflect.New(t).Elem()
+	err = dec.fillFixedArray(a, reflect.StructTag(""), def)
+	if err != nil {
+		return "", err
+	}
+	l := a.Len()
+	for i := 0; i < a.Len(); i++ {
+		if a.Index(i).Uint() == 0 {
+			l = i
+			break
+		}
+	}
+	if t.Elem().Kind() == reflect.Uint8 {
+		return decodeChars(a.Slice(0, l).Bytes(), dec.ch.CharacterEncoding, dec.codePage)
+	}
+	return decodeUTF16(a.Slice(0, l).Interface().([]uint16), dec.utf16Policy)
+}
+
+// writeFixedString writes a string as a fixed array padded with nulls.
+func (enc *Encoder) writeFixedString(s string, tag reflect.StructTag, def *[]deferedPtr) error {
+	t, err := fixedStringType(tag)
+	if err != nil {
+		return err
+	}
+	var u reflect.Value
+	if t.Elem().Kind() == reflect.Uint8 {
+		b, err := encodeChars(s, enc.ch.CharacterEncoding, enc.codePage)
+		if err != nil {
+			return err
+		}
+		u = reflect.ValueOf(b)
+	} else {
+		a, err := encodeUTF16(s, enc.utf16Policy)
+		if err != nil {
+			return err
+		}
+		u = reflect.ValueOf(a)
+	}
+	if u.Len() > t.Len() {
+		return fmt.Errorf("string of length %d does not fit in fixed array of length %d", u.Len(), t.Len())
+	}
+	a := reflect.New(t).Elem()
+	reflect.Copy(a, u)
+	return enc.writeFixedArray(a, reflect.StructTag(""), def)
+}
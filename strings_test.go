@@ -49,14 +49,17 @@ type TestStructWithFixedStringMultiArray struct {
 	A [2][3][2]string
 }
 
-func Test_uint16SliceToString(t *testing.T) {
+func Test_decodeUTF16(t *testing.T) {
 	b, _ := hex.DecodeString(TestStrUTF16Hex)
 	var u []uint16
 	for i := 0; i < len(b); i += 2 {
 		u = append(u, binary.LittleEndian.Uint16(b[i:i+2]))
 	}
-	s := uint16SliceToString(u)
-	assert.Equal(t, TestStr, s, "uint16SliceToString did not return as expected")
+	s, err := decodeUTF16(trimNull(u), UTF16Replace)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, TestStr, s, "decodeUTF16 did not return as expected")
 }
 
 func Test_readVaryingString(t *testing.T) {
@@ -65,7 +68,7 @@ func Test_readVaryingString(t *testing.T) {
 	hexStr := TestHeader + "00000000" + hex.EncodeToString(ac) + TestStrUTF16Hex // header:offset(0):actual count:data
 	b, _ := hex.DecodeString(hexStr)
 	a := new(TestStructWithVaryingString)
-	dec := NewDecoder(bytes.NewReader(b))
+	dec := NewDecoder(bytes.NewReader(b), true)
 	err := dec.Decode(a)
 	if err != nil {
 		t.Fatalf("%v", err)
@@ -79,7 +82,7 @@ func Test_readConformantVaryingString(t *testing.T) {
 	hexStr := TestHeader + hex.EncodeToString(ac) + "00000000" + hex.EncodeToString(ac) + TestStrUTF16Hex // header:max:offset(0):actual count:data
 	b, _ := hex.DecodeString(hexStr)
 	a := new(TestStructWithConformantVaryingString)
-	dec := NewDecoder(bytes.NewReader(b))
+	dec := NewDecoder(bytes.NewReader(b), true)
 	err := dec.Decode(a)
 	if err != nil {
 		t.Fatalf("%v", err)
@@ -94,7 +97,7 @@ func Test_readConformantStringUniDimensionalArray(t *testing.T) {
 	hexStr = TestHeader + "04000000" + hex.EncodeToString(ac) + "0000000004000000" + hexStr + "0000" + hexStr + "0000" + hexStr + "0000" + hexStr // header:1st dimension count(4):max for all strings:offset for 1st dim:actual for 1st dim:string array elements(4) with offset and actual counts. Need to include some bytes for alignment.
 	b, _ := hex.DecodeString(hexStr)
 	a := new(TestStructWithConformantVaryingStringUniArray)
-	dec := NewDecoder(bytes.NewReader(b))
+	dec := NewDecoder(bytes.NewReader(b), true)
 	err := dec.Decode(a)
 	if err != nil {
 		t.Fatalf("%v", err)
@@ -118,7 +121,7 @@ func Test_readConformantStringMultiDimensionalArray(t *testing.T) {
 	hexStr = TestHeader + "02000000" + "03000000" + "02000000" + hex.EncodeToString(ac) + "0000000002000000" + "0000000003000000" + "0000000002000000" + hexStr
 	b, _ := hex.DecodeString(hexStr)
 	a := new(TestStructWithConformantVaryingStringMultiArray)
-	dec := NewDecoder(bytes.NewReader(b))
+	dec := NewDecoder(bytes.NewReader(b), true)
 	err := dec.Decode(a)
 	if err != nil {
 		t.Fatalf("%v", err)
@@ -145,7 +148,7 @@ func Test_readNonConformantStringUniDimensionalArray(t *testing.T) {
 	hexStr = TestHeader + "0000000004000000" + hexStr + "0000" + hexStr + "0000" + hexStr + "0000" + hexStr // header:offset for 1st dim:actual for 1st dim:string array elements(4) with offset and actual counts. Need to include some bytes for alignment.
 	b, _ := hex.DecodeString(hexStr)
 	a := new(TestStructWithNonConformantStringUniArray)
-	dec := NewDecoder(bytes.NewReader(b))
+	dec := NewDecoder(bytes.NewReader(b), true)
 	err := dec.Decode(a)
 	if err != nil {
 		t.Fatalf("%v", err)
@@ -169,7 +172,7 @@ func Test_readNonConformantStringMultiDimensionalArray(t *testing.T) {
 	hexStr = TestHeader + "0000000002000000" + "0000000003000000" + "0000000002000000" + hexStr
 	b, _ := hex.DecodeString(hexStr)
 	a := new(TestStructWithNonConformantStringMultiArray)
-	dec := NewDecoder(bytes.NewReader(b))
+	dec := NewDecoder(bytes.NewReader(b), true)
 	err := dec.Decode(a)
 	if err != nil {
 		t.Fatalf("%v", err)
@@ -196,7 +199,7 @@ func Test_readFixedStringUniDimensionalArray(t *testing.T) {
 	hexStr = TestHeader + hexStr + "0000" + hexStr + "0000" + hexStr + "0000" + hexStr // header:offset for 1st dim:actual for 1st dim:string array elements(4) with offset and actual counts. Need to include some bytes for alignment.
 	b, _ := hex.DecodeString(hexStr)
 	a := new(TestStructWithFixedStringUniArray)
-	dec := NewDecoder(bytes.NewReader(b))
+	dec := NewDecoder(bytes.NewReader(b), true)
 	err := dec.Decode(a)
 	if err != nil {
 		t.Fatalf("%v", err)
@@ -219,7 +222,7 @@ func Test_readFixedStringMultiDimensionalArray(t *testing.T) {
 	hexStr = TestHeader + hexStr
 	b, _ := hex.DecodeString(hexStr)
 	a := new(TestStructWithFixedStringMultiArray)
-	dec := NewDecoder(bytes.NewReader(b))
+	dec := NewDecoder(bytes.NewReader(b), true)
 	err := dec.Decode(a)
 	if err != nil {
 		t.Fatalf("%v", err)
@@ -238,3 +241,231 @@ func Test_readFixedStringMultiDimensionalArray(t *testing.T) {
 	}
 	assert.Equal(t, ar, a.A, "fixed multi-dimensional string array not as expected")
 }
+
+type TestStructWithVaryingStringSkipNull struct {
+	A string `ndr:"varying,skipnull"`
+	B uint32
+}
+
+func Test_writeVaryingString(t *testing.T) {
+	ac := make([]byte, 4, 4)
+	binary.LittleEndian.PutUint32(ac, uint32(len(TestStrUTF16Hex)/4)) // actual count of number of uint16 bytes
+	expected := "00000000" + hex.EncodeToString(ac) + TestStrUTF16Hex // offset(0):actual count:data
+	for i, s := range []string{TestStr, TestStr + "\x00"} {
+		enc := NewEncoder(new(bytes.Buffer), false)
+		b, err := enc.Encode(&TestStructWithVaryingString{A: s})
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		assert.Equal(t, expected, hex.EncodeToString(b), "encoded varying string not as expected for test %d", i)
+
+		a := new(TestStructWithVaryingString)
+		dec := NewDecoder(bytes.NewReader(b), false)
+		err = dec.Decode(a)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		assert.Equal(t, TestStr, a.A, "value of decoded varying string not as expected for test %d", i)
+	}
+}
+
+func Test_writeVaryingStringSkipNull(t *testing.T) {
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&TestStructWithVaryingStringSkipNull{A: "ab", B: 1})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// offset(0):actual count:data without terminator:alignment:B
+	assert.Equal(t, "00000000"+"02000000"+"61006200"+"01000000", hex.EncodeToString(b), "encoded varying string not as expected")
+}
+
+func Test_writeConformantStringUniDimensionalArray(t *testing.T) {
+	ac := make([]byte, 4, 4)
+	binary.LittleEndian.PutUint32(ac, uint32(len(TestStrUTF16Hex)/4))                                                                // actual count of number of uint16 bytes
+	hexStr := "00000000" + hex.EncodeToString(ac) + TestStrUTF16Hex                                                                  // offset(0):actual count:data
+	hexStr = "04000000" + hex.EncodeToString(ac) + "0000000004000000" + hexStr + "0000" + hexStr + "0000" + hexStr + "0000" + hexStr // 1st dimension count(4):max for all strings:offset for 1st dim:actual for 1st dim:string array elements(4)
+	a := TestStructWithConformantVaryingStringUniArray{A: []string{TestStr, TestStr, TestStr, TestStr}}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, hexStr, hex.EncodeToString(b), "encoded conformant string array not as expected")
+}
+
+func Test_writeNonConformantStringUniDimensionalArray(t *testing.T) {
+	ac := make([]byte, 4, 4)
+	binary.LittleEndian.PutUint32(ac, uint32(len(TestStrUTF16Hex)/4))                          // actual count of number of uint16 bytes
+	hexStr := "00000000" + hex.EncodeToString(ac) + TestStrUTF16Hex                            // offset(0):actual count:data
+	hexStr = "0000000004000000" + hexStr + "0000" + hexStr + "0000" + hexStr + "0000" + hexStr // offset for 1st dim:actual for 1st dim:string array elements(4)
+	a := TestStructWithNonConformantStringUniArray{A: []string{TestStr, TestStr, TestStr, TestStr}}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, hexStr, hex.EncodeToString(b), "encoded non-conformant string array not as expected")
+}
+
+func Test_writeStringArrayCommonMax(t *testing.T) {
+	a := TestStructWithConformantVaryingStringUniArray{A: []string{"a", "abc", ""}}
+	enc := NewEncoder(new(bytes.Buffer), true)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// header:referent:dimension max(3):common max(4 including terminator)
+	assert.Equal(t, "0300000004000000", hex.EncodeToString(b[20:28]), "conformant max counts not as expected")
+
+	d := new(TestStructWithConformantVaryingStringUniArray)
+	dec := NewDecoder(bytes.NewReader(b), true)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "string array not as expected after round trip")
+}
+
+func Test_writeConformantStringMultiDimensionalArray(t *testing.T) {
+	ac := make([]byte, 4, 4)
+	binary.LittleEndian.PutUint32(ac, uint32(len(TestStrUTF16Hex)/4)) // actual count of number of uint16 bytes
+	strb := "00000000" + hex.EncodeToString(ac) + TestStrUTF16Hex     // offset(0):actual count:data
+	hexStr := strb
+	for i := 1; i < 12; i++ {
+		hexStr = hexStr + "0000" + strb
+	}
+	hexStr = "02000000" + "03000000" + "02000000" + hex.EncodeToString(ac) + "0000000002000000" + "0000000003000000" + "0000000002000000" + hexStr
+	a := TestStructWithConformantVaryingStringMultiArray{A: [][][]string{
+		{
+			{TestStr, TestStr},
+			{TestStr, TestStr},
+			{TestStr, TestStr},
+		},
+		{
+			{TestStr, TestStr},
+			{TestStr, TestStr},
+			{TestStr, TestStr},
+		},
+	}}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, hexStr, hex.EncodeToString(b), "encoded conformant multi-dimensional string array not as expected")
+}
+
+func Test_writeFixedStringMultiDimensionalArray(t *testing.T) {
+	a := TestStructWithFixedStringMultiArray{A: [2][3][2]string{
+		{
+			{TestStr, "a"},
+			{TestStr, "b"},
+			{TestStr, "c"},
+		},
+		{
+			{"d", TestStr},
+			{"e", TestStr},
+			{"f", TestStr},
+		},
+	}}
+	enc := NewEncoder(new(bytes.Buffer), true)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	d := new(TestStructWithFixedStringMultiArray)
+	dec := NewDecoder(bytes.NewReader(b), true)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "fixed multi-dimensional string array not as expected after round trip")
+}
+
+type TestStructWithStringMaxCount struct {
+	MaxCount uint16
+	A        string `ndr:"pointer,conformant,varying,skipnull,size_is:MaxCount"`
+}
+
+func Test_writeConformantVaryingStringMaxCount(t *testing.T) {
+	var tests = []struct {
+		In  TestStructWithStringMaxCount
+		Hex string
+	}{
+		// MaxCount:alignment:ptr:max:offset:actual count:data
+		{TestStructWithStringMaxCount{MaxCount: 10, A: "ab"}, "0a00" + "0000" + "00000200" + "0a000000" + "00000000" + "02000000" + "61006200"},
+		{TestStructWithStringMaxCount{MaxCount: 4, A: ""}, "0400" + "0000" + "00000200" + "04000000" + "00000000" + "00000000"},
+	}
+	for i, test := range tests {
+		enc := NewEncoder(new(bytes.Buffer), false)
+		b, err := enc.Encode(&test.In)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		assert.Equal(t, test.Hex, hex.EncodeToString(b), "encoded string not as expected for test %d", i)
+
+		a := new(TestStructWithStringMaxCount)
+		dec := NewDecoder(bytes.NewReader(b), false)
+		err = dec.Decode(a)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		assert.Equal(t, test.In, *a, "string not as expected after round trip for test %d", i)
+	}
+
+	enc := NewEncoder(new(bytes.Buffer), false)
+	_, err := enc.Encode(&TestStructWithStringMaxCount{MaxCount: 1, A: "ab"})
+	if err == nil {
+		t.Errorf("expected error when max count is less than the length of the string")
+	}
+}
+
+type TestStructWithFixedString struct {
+	A string `ndr:"fixed:4"`
+	B string `ndr:"char,fixed:3"`
+	C uint16
+}
+
+func TestFixedString(t *testing.T) {
+	var tests = []struct {
+		In  TestStructWithFixedString
+		Hex string
+	}{
+		// A null padded:B null padded:padding:C
+		{TestStructWithFixedString{A: "ab", B: "x", C: 1}, "6100620000000000" + "780000" + "00" + "0100"},
+		// Strings filling the whole array have no null terminator
+		{TestStructWithFixedString{A: "abcd", B: "xyz", C: 1}, "6100620063006400" + "78797a" + "00" + "0100"},
+	}
+	for i, test := range tests {
+		enc := NewEncoder(new(bytes.Buffer), false)
+		b, err := enc.Encode(&test.In)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		assert.Equal(t, test.Hex, hex.EncodeToString(b), "encoded string not as expected for test %d", i)
+
+		a := new(TestStructWithFixedString)
+		dec := NewDecoder(bytes.NewReader(b), false)
+		err = dec.Decode(a)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		assert.Equal(t, test.In, *a, "string not as expected after round trip for test %d", i)
+	}
+
+	// Decoding truncates at the first null
+	b, _ := hex.DecodeString("6100000062000000" + "000079" + "00" + "0100")
+	a := new(TestStructWithFixedString)
+	dec := NewDecoder(bytes.NewReader(b), false)
+	err := dec.Decode(a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, TestStructWithFixedString{A: "a", B: "", C: 1}, *a, "string not as expected")
+
+	enc := NewEncoder(new(bytes.Buffer), false)
+	_, err = enc.Encode(&TestStructWithFixedString{A: "abcde"})
+	if err == nil {
+		t.Errorf("expected error when the string does not fit in the fixed array")
+	}
+}
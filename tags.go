@@ -50,10 +50,13 @@ func (t *tags) StructTag() reflect.StructTag {
 	return reflect.StructTag(s)
 }
 
+// delete removes the first occurrence of the value s and the key s. Repeated values, such as pointer,pointer for a
+// double pointer, are therefore removed one at a time.
 func (t *tags) delete(s string) {
 	for i, x := range t.Values {
 		if x == s {
 			t.Values = append(t.Values[:i], t.Values[i+1:]...)
+			break
 		}
 	}
 	delete(t.Map, s)
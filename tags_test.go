@@ -35,3 +35,11 @@ func TestParseTags(t *testing.T) {
 	assert.Equal(t, []string{}, tg3.Values, "Values not as expected for test %d", 3)
 	assert.Equal(t, make(map[string]string), tg3.Map, "Map not as expected for test %d", 3)
 }
+
+func TestDeleteTag(t *testing.T) {
+	tg := parseTags(reflect.StructTag(`ndr:"pointer,pointer,conformant"`))
+	tg.delete(TagPointer)
+	assert.Equal(t, []string{"pointer", "conformant"}, tg.Values, "only the first value should be deleted")
+	tg.delete(TagPointer)
+	assert.Equal(t, []string{"conformant"}, tg.Values, "Values not as expected")
+}
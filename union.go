@@ -55,3 +55,19 @@ func unionSelectedField(union, discriminant reflect.Value) (string, error) {
 	}
 	return f[0].String(), nil
 }
+
+func (enc *Encoder) isUnion(field reflect.Value, tag reflect.StructTag) (r reflect.Value, err error) {
+	ndrTag := parseTags(tag)
+	if !ndrTag.HasValue(TagUnionTag) {
+		return
+	}
+	r = field
+	// For a non-encapsulated union, the discriminant is marshalled into the transmitted data stream twice: once as the
+	// field or parameter, which is referenced by the switch_is construct, in the procedure argument list; and once as
+	// the first part of the union representation.
+	// The field itself is written by the caller so only the extra copy is written here.
+	if !ndrTag.HasValue(TagEncapsulated) {
+		err = enc.fill(field, reflect.StructTag(""), &[]deferedPtr{})
+	}
+	return
+}
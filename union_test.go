@@ -27,6 +27,23 @@ type testUnionNonEncapsulated struct {
 	Value2 uint16 `ndr:"unionField"`
 }
 
+type testUnionPaddedArm struct {
+	Tag    uint16 `ndr:"unionTag,encapsulated"`
+	Value1 uint8  `ndr:"unionField"`
+	Value2 uint64 `ndr:"unionField"`
+}
+
+func (u testUnionPaddedArm) SwitchFunc(tag interface{}) string {
+	t := tag.(uint16)
+	switch t {
+	case 1:
+		return "Value1"
+	case 2:
+		return "Value2"
+	}
+	return ""
+}
+
 func (u testUnionEncapsulated) SwitchFunc(tag interface{}) string {
 	t := tag.(uint32)
 	switch t {
@@ -64,7 +81,7 @@ func Test_readUnionEncapsulated(t *testing.T) {
 		a := new(testUnionEncapsulated)
 		hexStr := TestHeader + test.Hex
 		b, _ := hex.DecodeString(hexStr)
-		dec := NewDecoder(bytes.NewReader(b))
+		dec := NewDecoder(bytes.NewReader(b), true)
 		err := dec.Decode(a)
 		if err != nil {
 			t.Fatalf("test %d: %v", i+1, err)
@@ -91,7 +108,7 @@ func Test_readUnionNonEncapsulated(t *testing.T) {
 		a := new(testUnionNonEncapsulated)
 		hexStr := TestHeader + test.Hex
 		b, _ := hex.DecodeString(hexStr)
-		dec := NewDecoder(bytes.NewReader(b))
+		dec := NewDecoder(bytes.NewReader(b), true)
 		err := dec.Decode(a)
 		if err != nil {
 			t.Fatalf("test %d: %v", i+1, err)
@@ -102,3 +119,103 @@ func Test_readUnionNonEncapsulated(t *testing.T) {
 
 	}
 }
+
+func Test_writeUnionEncapsulated(t *testing.T) {
+	var tests = []struct {
+		Hex string
+		In  testUnionEncapsulated
+		Out testUnionEncapsulated // arms that are not selected are not encoded
+	}{
+		{testUnionSelected1Enc, testUnionEncapsulated{Tag: 1, Value1: 1, Value2: 2}, testUnionEncapsulated{Tag: 1, Value1: 1}},
+		{testUnionSelected2Enc, testUnionEncapsulated{Tag: 2, Value1: 1, Value2: 2}, testUnionEncapsulated{Tag: 2, Value2: 2}},
+	}
+
+	for i, test := range tests {
+		enc := NewEncoder(new(bytes.Buffer), false)
+		b, err := enc.Encode(&test.In)
+		if err != nil {
+			t.Fatalf("test %d: %v", i+1, err)
+		}
+		assert.Equal(t, test.Hex, hex.EncodeToString(b), "encoded union not as expected for test: %d", i+1)
+
+		a := new(testUnionEncapsulated)
+		dec := NewDecoder(bytes.NewReader(b), false)
+		err = dec.Decode(a)
+		if err != nil {
+			t.Fatalf("test %d: %v", i+1, err)
+		}
+		assert.Equal(t, test.Out, *a, "union not as expected after round trip for test: %d", i+1)
+	}
+}
+
+func Test_writeUnionNonEncapsulated(t *testing.T) {
+	var tests = []struct {
+		Hex string
+		In  testUnionNonEncapsulated
+		Out testUnionNonEncapsulated // arms that are not selected are not encoded
+	}{
+		{testUnionSelected1NonEnc, testUnionNonEncapsulated{Tag: 1, Value1: 1, Value2: 2}, testUnionNonEncapsulated{Tag: 1, Value1: 1}},
+		{testUnionSelected2NonEnc, testUnionNonEncapsulated{Tag: 2, Value1: 1, Value2: 2}, testUnionNonEncapsulated{Tag: 2, Value2: 2}},
+	}
+
+	for i, test := range tests {
+		enc := NewEncoder(new(bytes.Buffer), false)
+		b, err := enc.Encode(&test.In)
+		if err != nil {
+			t.Fatalf("test %d: %v", i+1, err)
+		}
+		assert.Equal(t, test.Hex, hex.EncodeToString(b), "encoded union not as expected for test: %d", i+1)
+
+		a := new(testUnionNonEncapsulated)
+		dec := NewDecoder(bytes.NewReader(b), false)
+		err = dec.Decode(a)
+		if err != nil {
+			t.Fatalf("test %d: %v", i+1, err)
+		}
+		assert.Equal(t, test.Out, *a, "union not as expected after round trip for test: %d", i+1)
+	}
+}
+
+func Test_unionRoundTripWithHeader(t *testing.T) {
+	in := testUnionNonEncapsulated{Tag: 2, Value2: 0x1234}
+	enc := NewEncoder(new(bytes.Buffer), true)
+	b, err := enc.Encode(&in)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	a := new(testUnionNonEncapsulated)
+	dec := NewDecoder(bytes.NewReader(b), true)
+	err = dec.Decode(a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, in, *a, "union not as expected after round trip")
+}
+
+func Test_writeUnionPaddedArm(t *testing.T) {
+	// In NDR each arm is aligned by its own type rather than the largest alignment of the arms
+	var tests = []struct {
+		Hex string
+		In  testUnionPaddedArm
+	}{
+		{"0100" + "01", testUnionPaddedArm{Tag: 1, Value1: 1}},
+		{"0200" + "000000000000" + "0100000000000000", testUnionPaddedArm{Tag: 2, Value2: 1}}, // tag:padding:Value2
+	}
+
+	for i, test := range tests {
+		enc := NewEncoder(new(bytes.Buffer), false)
+		b, err := enc.Encode(&test.In)
+		if err != nil {
+			t.Fatalf("test %d: %v", i+1, err)
+		}
+		assert.Equal(t, test.Hex, hex.EncodeToString(b), "encoded union not as expected for test: %d", i+1)
+
+		a := new(testUnionPaddedArm)
+		dec := NewDecoder(bytes.NewReader(b), false)
+		err = dec.Decode(a)
+		if err != nil {
+			t.Fatalf("test %d: %v", i+1, err)
+		}
+		assert.Equal(t, test.In, *a, "union not as expected after round trip for test: %d", i+1)
+	}
+}
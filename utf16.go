@@ -0,0 +1,171 @@
+package ndr
+
+import (
+	"fmt"
+	"reflect"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+/*
+UTF-16 strings
+
+Strings are marshalled as UTF-16 with characters outside the BMP encoded as surrogate pairs. Windows allows unpaired
+surrogates, for example in file, share and registry names, which cannot be represented in valid UTF-8. The UTF16Policy
+selects how these are handled:
+- UTF16Replace, the default, replaces unpaired surrogates and invalid UTF-8 with the replacement character U+FFFD.
+- UTF16Strict returns an error for unpaired surrogates and invalid UTF-8. Encoder.ToUnicode, which cannot return an
+  error, replaces them instead, while Encoder.EncodeUTF16 returns the error.
+- UTF16Lossless encodes unpaired surrogates in the Go string as the 3 bytes of the generalized UTF-8 encoding of the
+  code unit, as in WTF-8, so that encoding the string gives back the exact original code units.
+
+A []uint16 field tagged with "string" is marshalled as a string but keeps the raw code units, apart from the null
+terminator.
+*/
+
+// UTF16Policy selects how unpaired surrogates and invalid UTF-8 are handled when converting between Go strings and
+// UTF-16.
+type UTF16Policy int
+
+// UTF-16 policies
+const (
+	UTF16Replace  UTF16Policy = iota // replace invalid sequences with U+FFFD
+	UTF16Strict                      // return an error for invalid sequences. Not applied by Encoder.ToUnicode
+	UTF16Lossless                    // keep unpaired surrogates using the WTF-8 encoding
+)
+
+const (
+	surrogateMin     = 0xD800
+	lowSurrogateMin  = 0xDC00
+	surrogateMax     = 0xDFFF
+	supplementaryMin = 0x10000
+)
+
+// SetUTF16Policy selects how unpaired surrogates in UTF-16 strings are handled.
+func (dec *Decoder) SetUTF16Policy(p UTF16Policy) {
+	dec.utf16Policy = p
+}
+
+// SetUTF16Policy selects how invalid UTF-8, or WTF-8 encoded unpaired surrogates, in strings are handled.
+func (enc *Encoder) SetUTF16Policy(p UTF16Policy) {
+	enc.utf16Policy = p
+}
+
+// decodeUTF16 converts UTF-16 code units to a string.
+func decodeUTF16(a []uint16, p UTF16Policy) (string, error) {
+	b := make([]byte, 0, len(a))
+	for i := 0; i < len(a); i++ {
+		u := a[i]
+		switch {
+		case u < surrogateMin || u > surrogateMax:
+			b = utf8.AppendRune(b, rune(u))
+		case u < lowSurrogateMin && i+1 < len(a) && a[i+1] >= lowSurrogateMin && a[i+1] <= surrogateMax:
+			b = utf8.AppendRune(b, utf16.DecodeRune(rune(u), rune(a[i+1])))
+			i++
+		case p == UTF16Strict:
+			return "", fmt.Errorf("unpaired surrogate %#04x at index %d of UTF-16 string", u, i)
+		case p == UTF16Lossless:
+			b = append(b, 0xE0|byte(u>>12), 0x80|byte(u>>6)&0x3F, 0x80|byte(u)&0x3F)
+		default:
+			b = utf8.AppendRune(b, utf8.RuneError)
+		}
+	}
+	return string(b), nil
+}
+
+// encodeUTF16 converts a string to UTF-16 code units.
+func encodeUTF16(s string, p UTF16Policy) ([]uint16, error) {
+	a := make([]uint16, 0, len(s))
+	for i := 0; i < len(s); {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && n == 1 {
+			if p == UTF16Lossless && isWTF8Surrogate(s[i:]) {
+				a = append(a, uint16(s[i]&0x0F)<<12|uint16(s[i+1]&0x3F)<<6|uint16(s[i+2]&0x3F))
+				i += 3
+				continue
+			}
+			if p == UTF16Strict {
+				return nil, fmt.Errorf("invalid UTF-8 at byte %d of string", i)
+			}
+		}
+		if r >= supplementaryMin {
+			r1, r2 := utf16.EncodeRune(r)
+			a = append(a, uint16(r1), uint16(r2))
+		} else {
+			a = append(a, uint16(r))
+		}
+		i += n
+	}
+	return a, nil
+}
+
+// isWTF8Surrogate reports whether s starts with the generalized UTF-8 encoding of a surrogate code unit.
+func isWTF8Surrogate(s string) bool {
+	return len(s) >= 3 && s[0] == 0xED && s[1] >= 0xA0 && s[1] <= 0xBF && s[2] >= 0x80 && s[2] <= 0xBF
+}
+
+// isUnitString reports whether v is a []uint16 tagged to be marshalled as a string of raw code units.
+func isUnitString(v reflect.Value, tag reflect.StructTag) bool {
+	ndrTag := parseTags(tag)
+	return ndrTag.HasValue(TagString) && v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint16
+}
+
+// unitString returns the code units of a []uint16 string with a null terminator appended unless skipNull is set.
+func unitString(v reflect.Value, skipNull bool) []uint16 {
+	a := make([]uint16, v.Len(), v.Len()+1)
+	for i := range a {
+		a[i] = uint16(v.Index(i).Uint())
+	}
+	if !skipNull && (len(a) == 0 || a[len(a)-1] != 0) {
+		a = append(a, 0)
+	}
+	return a
+}
+
+// trimNull removes any null terminator from UTF-16 code units.
+func trimNull(a []uint16) []uint16 {
+	if len(a) > 0 && a[len(a)-1] == 0 {
+		return a[:len(a)-1]
+	}
+	return a
+}
+
+func (dec *Decoder) fillUnitString(v reflect.Value, tag reflect.StructTag, def *[]deferedPtr) error {
+	ndrTag := parseTags(tag)
+	a := new([]uint16)
+	var err error
+	if ndrTag.HasValue(TagConformant) {
+		err = dec.fillUniDimensionalConformantVaryingArray(reflect.ValueOf(a).Elem(), correlationTag(tag), def)
+	} else {
+		err = dec.fillUniDimensionalVaryingArray(reflect.ValueOf(a).Elem(), correlationTag(tag), def)
+	}
+	if err != nil {
+		return fmt.Errorf("could not fill UTF-16 string: %v", err)
+	}
+	u := trimNull(*a)
+	s := reflect.MakeSlice(v.Type(), len(u), len(u))
+	for i := range u {
+		s.Index(i).SetUint(uint64(u[i]))
+	}
+	v.Set(s)
+	return nil
+}
+
+// writeVaryingUnits writes UTF-16 code units preceded by the offset and actual count.
+func (enc *Encoder) writeVaryingUnits(a []uint16) error {
+	err := enc.writeCount(0) // offset
+	if err != nil {
+		return fmt.Errorf("could not write offset of varying string: %v", err)
+	}
+	err = enc.writeCount(uint32(len(a)))
+	if err != nil {
+		return fmt.Errorf("could not write actual count of varying string: %v", err)
+	}
+	for _, u := range a {
+		err = enc.writeUint16(u)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package ndr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testUTF16String struct {
+	A string `ndr:"conformant"`
+}
+
+type testUnitString struct {
+	A []uint16 `ndr:"conformant,string"`
+	B []uint16 `ndr:"string"`
+}
+
+func TestSurrogatePairs(t *testing.T) {
+	a := testUTF16String{A: "a😀"}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// max count:offset:actual count:a:surrogate pair:null terminator
+	assert.Equal(t, "04000000"+"00000000"+"04000000"+"6100"+"3dd800de"+"0000", hex.EncodeToString(b), "encoded bytes not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), false)
+	d := new(testUTF16String)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "value not as expected after round trip")
+}
+
+func TestUnpairedSurrogates(t *testing.T) {
+	// a, unpaired high surrogate, b, unpaired low surrogate
+	u := []uint16{0x61, 0xD800, 0x62, 0xDC00}
+	var tests = []struct {
+		Policy UTF16Policy
+		Str    string
+	}{
+		{UTF16Replace, "a�b�"},
+		{UTF16Lossless, "a\xed\xa0\x80b\xed\xb0\x80"},
+	}
+	for i, test := range tests {
+		s, err := decodeUTF16(u, test.Policy)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		assert.Equal(t, test.Str, s, "string not as expected for test %d", i)
+	}
+	_, err := decodeUTF16(u, UTF16Strict)
+	if err == nil {
+		t.Errorf("expected error decoding an unpaired surrogate in strict mode")
+	}
+
+	// The lossless mode round trips through the encoder and decoder
+	a := testUTF16String{A: tests[1].Str}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	enc.SetUTF16Policy(UTF16Lossless)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, "05000000"+"00000000"+"05000000"+"610000d8620000dc0000"+"0000", hex.EncodeToString(b), "encoded bytes not as expected")
+	dec := NewDecoder(bytes.NewReader(b), false)
+	dec.SetUTF16Policy(UTF16Lossless)
+	d := new(testUTF16String)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "value not as expected after round trip")
+
+	enc = NewEncoder(new(bytes.Buffer), false)
+	enc.SetUTF16Policy(UTF16Strict)
+	_, err = enc.Encode(&a)
+	if err == nil {
+		t.Errorf("expected error encoding invalid UTF-8 in strict mode")
+	}
+}
+
+func TestStrictPolicy(t *testing.T) {
+	a := testUTF16String{A: "a\xed\xa0\x80"}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	enc.SetUTF16Policy(UTF16Strict)
+	err := enc.conformantScan(&a, "")
+	if err == nil {
+		t.Errorf("expected error counting invalid UTF-8 in strict mode")
+	}
+
+	_, err = enc.EncodeUTF16(a.A)
+	if err == nil {
+		t.Errorf("expected error converting invalid UTF-8 in strict mode")
+	}
+	b, err := enc.EncodeUTF16("a")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, "6100", hex.EncodeToString(b), "encoded bytes not as expected")
+	// ToUnicode cannot return the error so replaces each invalid byte instead
+	assert.Equal(t, "6100"+"fdfffdfffdff", hex.EncodeToString(enc.ToUnicode(a.A)), "encoded bytes not as expected")
+}
+
+func TestUnitStrings(t *testing.T) {
+	a := testUnitString{A: []uint16{0x61, 0xDC00}, B: []uint16{}}
+	enc := NewEncoder(new(bytes.Buffer), false)
+	b, err := enc.Encode(&a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// A max count:A offset:A actual count:A units:null terminator:padding:B offset:B actual count:null terminator
+	assert.Equal(t, "03000000"+"00000000"+"03000000"+"610000dc0000"+"0000"+"00000000"+"01000000"+"0000",
+		hex.EncodeToString(b), "encoded bytes not as expected")
+
+	dec := NewDecoder(bytes.NewReader(b), false)
+	d := new(testUnitString)
+	err = dec.Decode(d)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, a, *d, "value not as expected after round trip")
+}
@@ -1,65 +1,110 @@
 package ndr
 
 import (
+	"bytes"
+	"cmp"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
-	"regexp"
-	"strconv"
 	"strings"
 )
 
-var re regexp.Regexp = *regexp.MustCompile(`([\dA-Fa-f]{8})-([\dA-Fa-f]{4})-([\dA-Fa-f]{4})-([\dA-Fa-f]{4})-([\dA-Fa-f]{4})([\dA-Fa-f]{8})`)
-
-func uuid_to_bin(uuid string) ([]byte, error) {
-	//log.Debugln("In uuid_to_bin")
+// GUID implements a GUID, or UUID, as the NDR struct {uint32, uint16, uint16, [8]byte} so that it is marshalled in
+// the endianness of the byte stream: https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-dtyp/49e490b8-f972-45d6-a3a4-99f924998d97
+type GUID struct {
+	Data1 uint32
+	Data2 uint16
+	Data3 uint16
+	Data4 [8]byte
+}
 
-	if !strings.ContainsRune(uuid, '-') {
-		return hex.DecodeString(uuid)
+// ParseGUID parses a GUID in the string form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx, optionally enclosed in braces.
+func ParseGUID(s string) (GUID, error) {
+	var g GUID
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		s = s[1 : len(s)-1]
 	}
-
-	// Assume Variant 2 UUID
-	matches := re.FindAllStringSubmatch(uuid, -1)
-	if (len(matches) == 0) || (len(matches[0]) != 7) {
-		return nil, fmt.Errorf("Failed to parse UUID v2 string")
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return g, fmt.Errorf("invalid GUID string %q", s)
 	}
-	uuid1, uuid2, uuid3, uuid4, uuid5, uuid6 := matches[0][1], matches[0][2], matches[0][3], matches[0][4], matches[0][5], matches[0][6]
-	buf := make([]byte, 0)
-	n, err := strconv.ParseUint(uuid1, 16, 32)
+	b, err := hex.DecodeString(s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:36])
 	if err != nil {
-		return nil, err
-	}
-	buf = binary.LittleEndian.AppendUint32(buf, uint32(n))
-	n, err = strconv.ParseUint(uuid2, 16, 16)
-	if err != nil {
-		return nil, err
+		return g, fmt.Errorf("invalid GUID string %q: %v", s, err)
 	}
+	g.Data1 = binary.BigEndian.Uint32(b[0:4])
+	g.Data2 = binary.BigEndian.Uint16(b[4:6])
+	g.Data3 = binary.BigEndian.Uint16(b[6:8])
+	copy(g.Data4[:], b[8:])
+	return g, nil
+}
 
-	buf = binary.LittleEndian.AppendUint16(buf, uint16(n))
-	n, err = strconv.ParseUint(uuid3, 16, 16)
+// MustParseGUID parses a GUID like ParseGUID but panics if the string cannot be parsed. It simplifies the
+// initialisation of global variables such as interface IDs.
+func MustParseGUID(s string) GUID {
+	g, err := ParseGUID(s)
 	if err != nil {
-		return nil, err
+		panic(err)
 	}
+	return g
+}
 
-	buf = binary.LittleEndian.AppendUint16(buf, uint16(n))
-	n, err = strconv.ParseUint(uuid4, 16, 16)
-	if err != nil {
-		return nil, err
+// GUIDFromBytes returns the GUID of the 16 byte little-endian representation used by Windows.
+func GUIDFromBytes(b []byte) (GUID, error) {
+	var g GUID
+	if len(b) != 16 {
+		return g, fmt.Errorf("GUID must be 16 bytes, not %d", len(b))
 	}
+	g.Data1 = binary.LittleEndian.Uint32(b[0:4])
+	g.Data2 = binary.LittleEndian.Uint16(b[4:6])
+	g.Data3 = binary.LittleEndian.Uint16(b[6:8])
+	copy(g.Data4[:], b[8:])
+	return g, nil
+}
 
-	buf = binary.BigEndian.AppendUint16(buf, uint16(n))
-	n, err = strconv.ParseUint(uuid5, 16, 16)
-	if err != nil {
-		return nil, err
+// Bytes returns the 16 byte little-endian representation of the GUID used by Windows.
+func (g GUID) Bytes() []byte {
+	b := make([]byte, 0, 16)
+	b = binary.LittleEndian.AppendUint32(b, g.Data1)
+	b = binary.LittleEndian.AppendUint16(b, g.Data2)
+	b = binary.LittleEndian.AppendUint16(b, g.Data3)
+	return append(b, g.Data4[:]...)
+}
+
+// String returns the GUID in the lower case string form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx.
+func (g GUID) String() string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x", g.Data1, g.Data2, g.Data3, g.Data4[:2], g.Data4[2:])
+}
+
+// IsZero reports whether the GUID is the nil GUID of all zeros.
+func (g GUID) IsZero() bool {
+	return g == GUID{}
+}
+
+// Equal reports whether the GUIDs are the same.
+func (g GUID) Equal(o GUID) bool {
+	return g == o
+}
+
+// Compare returns -1, 0 or +1 when g is less than, equal to or greater than o, ordering the fields in turn.
+func (g GUID) Compare(o GUID) int {
+	switch {
+	case g.Data1 != o.Data1:
+		return cmp.Compare(g.Data1, o.Data1)
+	case g.Data2 != o.Data2:
+		return cmp.Compare(g.Data2, o.Data2)
+	case g.Data3 != o.Data3:
+		return cmp.Compare(g.Data3, o.Data3)
 	}
+	return bytes.Compare(g.Data4[:], o.Data4[:])
+}
 
-	buf = binary.BigEndian.AppendUint16(buf, uint16(n))
-	n, err = strconv.ParseUint(uuid6, 16, 32)
+func uuid_to_bin(uuid string) ([]byte, error) {
+	if !strings.ContainsRune(uuid, '-') {
+		return hex.DecodeString(uuid)
+	}
+	g, err := ParseGUID(uuid)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("Failed to parse UUID v2 string")
 	}
-
-	buf = binary.BigEndian.AppendUint32(buf, uint32(n))
-
-	return buf, nil
+	return g.Bytes(), nil
 }
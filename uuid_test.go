@@ -0,0 +1,89 @@
+package ndr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testGUID = "8a885d04-1ceb-11c9-9fe8-08002b104860"
+
+type testGUIDStruct struct {
+	A uint16
+	B GUID
+}
+
+func TestParseGUID(t *testing.T) {
+	g, err := ParseGUID(testGUID)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, GUID{0x8a885d04, 0x1ceb, 0x11c9, [8]byte{0x9f, 0xe8, 0x08, 0x00, 0x2b, 0x10, 0x48, 0x60}}, g, "GUID not as expected")
+	assert.Equal(t, testGUID, g.String(), "GUID string not as expected")
+	assert.Equal(t, "045d888aeb1cc9119fe808002b104860", hex.EncodeToString(g.Bytes()), "GUID bytes not as expected")
+	f, err := GUIDFromBytes(g.Bytes())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	assert.Equal(t, g, f, "GUID not as expected from bytes")
+	assert.Equal(t, g, MustParseGUID("{8A885D04-1CEB-11C9-9FE8-08002B104860}"), "GUID with braces not as expected")
+
+	for _, s := range []string{"", "8a885d04-1ceb-11c9-9fe8-08002b10486", "8a885d04x1ceb-11c9-9fe8-08002b104860", "8a885d04-1ceb-11c9-9fe8-08002b10486g"} {
+		_, err = ParseGUID(s)
+		if err == nil {
+			t.Errorf("expected error parsing %q", s)
+		}
+	}
+}
+
+func TestCompareGUID(t *testing.T) {
+	g := MustParseGUID(testGUID)
+	assert.True(t, g.Equal(MustParseGUID(testGUID)), "GUIDs should be equal")
+	assert.True(t, GUID{}.IsZero(), "GUID should be zero")
+	assert.False(t, g.IsZero(), "GUID should not be zero")
+	var tests = []struct {
+		A, B string
+		Cmp  int
+	}{
+		{testGUID, testGUID, 0},
+		{"8a885d03-1ceb-11c9-9fe8-08002b104860", testGUID, -1},
+		{"8a885d04-1ceb-11c9-9fe8-08002b104861", testGUID, 1},
+		{"8a885d04-1ceb-11c8-ffe8-08002b104860", testGUID, -1},
+	}
+	for i, test := range tests {
+		assert.Equal(t, test.Cmp, MustParseGUID(test.A).Compare(MustParseGUID(test.B)), "comparison not as expected for test %d", i)
+	}
+}
+
+func TestGUIDEndianness(t *testing.T) {
+	var tests = []struct {
+		Endian binary.ByteOrder
+		Hex    string
+	}{
+		// A:padding:GUID
+		{binary.LittleEndian, "0100" + "0000" + "045d888aeb1cc9119fe808002b104860"},
+		{binary.BigEndian, "0001" + "0000" + "8a885d041ceb11c99fe808002b104860"},
+	}
+	for i, test := range tests {
+		a := testGUIDStruct{A: 1, B: MustParseGUID(testGUID)}
+		enc := NewEncoder(new(bytes.Buffer), false)
+		enc.SetEndianness(test.Endian)
+		b, err := enc.Encode(&a)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		assert.Equal(t, test.Hex, hex.EncodeToString(b), "encoded bytes not as expected for test %d", i)
+
+		dec := NewDecoder(bytes.NewReader(b), false)
+		dec.SetEndianness(test.Endian)
+		d := new(testGUIDStruct)
+		err = dec.Decode(d)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		assert.Equal(t, a, *d, "value not as expected after round trip for test %d", i)
+	}
+}